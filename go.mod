@@ -1,22 +1,24 @@
-module gtml
+module github.com/phillip-england/gtml
 
 go 1.23.3
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/PuerkitoBio/goquery v1.10.0
 	github.com/alecthomas/chroma/v2 v2.14.0
 	github.com/fsnotify/fsnotify v1.8.0
+	github.com/joho/godotenv v1.5.1
 	github.com/phillip-england/fungi v1.0.1
 	github.com/phillip-england/gqpp v1.0.4
 	github.com/phillip-england/purse v1.0.18
 	github.com/yuin/goldmark v1.4.15
 	github.com/yuin/goldmark-highlighting/v2 v2.0.0-20230729083705-37449abec8cc
+	golang.org/x/net v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/andybalholm/cascadia v1.3.2 // indirect
 	github.com/dlclark/regexp2 v1.11.0 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	golang.org/x/net v0.30.0 // indirect
 	golang.org/x/sys v0.26.0 // indirect
 )
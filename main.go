@@ -2,10 +2,10 @@ package main
 
 import (
 	"fmt"
-	"gtml/src/cli"
 	"os"
 
 	"github.com/joho/godotenv"
+	"github.com/phillip-england/gtml/src/cli"
 )
 
 func main() {
@@ -15,7 +15,7 @@ func main() {
 	cmd, err := cli.NewCommand()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		return
+		os.Exit(1)
 	}
 	if cmd == nil {
 		return
@@ -24,13 +24,13 @@ func main() {
 	ex, err := cli.NewExecutor(cmd)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		return
+		os.Exit(1)
 	}
 
 	err = ex.Run()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		return
+		os.Exit(1)
 	}
 
 }
@@ -1,47 +1,1346 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
-func TestComponents(t *testing.T) {
-	cmd := exec.Command("go", "build", "main.go")
+// buildGtml builds gtml into a directory of its own for the test and
+// returns the path of the binary.
+func buildGtml(t *testing.T) string {
+	t.Helper()
+	gtml := filepath.Join(t.TempDir(), "gtml")
+	cmd := exec.Command("go", "build", "-o", gtml, "main.go")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	cmd.Env = append(os.Environ(), "PATH="+os.Getenv("PATH"))
+	err := cmd.Run()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	return gtml
+}
+
+// gtmlCommand returns a command running gtml with args in dir. Its build
+// cache is kept next to the binary, so tests never touch the cache of
+// the user running them.
+func gtmlCommand(gtml string, dir string, args ...string) *exec.Cmd {
+	cacheDir := filepath.Join(filepath.Dir(gtml), "cache")
+	cmd := exec.Command(gtml, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "XDG_CACHE_HOME="+cacheDir, "HOME="+cacheDir)
+	return cmd
+}
 
+// runGtml runs gtml with args in dir and fails the test if it fails.
+func runGtml(t *testing.T, gtml string, dir string, args ...string) {
+	t.Helper()
+	cmd := gtmlCommand(gtml, dir, args...)
+	cmd.Stderr = os.Stderr
 	err := cmd.Run()
 	if err != nil {
 		t.Fatalf("Error: %s", err)
 	}
+}
 
-	cmd = exec.Command("./main", "build", "./test/test_components", "./output.go", "main")
-	cmd.Stdout = os.Stdout
+// writeFiles writes files, keyed by their path within dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+		err = os.WriteFile(path, []byte(src), 0644)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+	}
+}
+
+// runGo runs the package in dir and returns what it printed.
+func runGo(t *testing.T, dir string) string {
+	t.Helper()
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
 	cmd.Stderr = os.Stderr
-	err = cmd.Run()
+	output, err := cmd.Output()
 	if err != nil {
 		t.Fatalf("Error: %s", err)
 	}
+	return string(output)
+}
+
+func TestComponents(t *testing.T) {
+	gtml := buildGtml(t)
+	output := filepath.Join(t.TempDir(), "output.go")
+	runGtml(t, gtml, ".", "build", "./test/test_components", output, "main")
 }
 
 func TestAll(t *testing.T) {
-	cmd := exec.Command("go", "build", "main.go")
-	cmd.Stdout = os.Stdout
+	gtml := buildGtml(t)
+	output := filepath.Join(t.TempDir(), "output.go")
+	runGtml(t, gtml, ".", "build", "./test/good_components", output, "main")
+}
+
+func TestCacheMatchesFullBuild(t *testing.T) {
+	gtml := buildGtml(t)
+	input, err := filepath.Abs("./test/good_components")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output.go")
+
+	// the second build is served from the cache written by the first
+	for i := 0; i < 2; i++ {
+		runGtml(t, gtml, dir, "build", input, output, "main")
+	}
+	cached, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	runGtml(t, gtml, dir, "--no-cache", "build", input, output, "main")
+	full, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if string(cached) != string(full) {
+		t.Fatalf("cached build differs from a full build")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	gtml := buildGtml(t)
+	output := filepath.Join(t.TempDir(), "output.go")
+
+	runGtml(t, gtml, ".", "build", "./test/good_components", output, "main")
+	cmd := gtmlCommand(gtml, ".", "--check", "build", "./test/good_components", output, "main")
 	cmd.Stderr = os.Stderr
-	cmd.Env = append(os.Environ(), "PATH="+os.Getenv("PATH"))
+	err := cmd.Run()
+	if err != nil {
+		t.Fatalf("--check failed on a freshly built file: %s", err)
+	}
 
+	f, err := os.OpenFile(output, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	f.WriteString("// drift\n")
+	f.Close()
+
+	err = gtmlCommand(gtml, ".", "--check", "build", "./test/good_components", output, "main").Run()
+	if err == nil {
+		t.Fatalf("--check passed on a file which was edited by hand")
+	}
+}
+
+func TestOutDir(t *testing.T) {
+	gtml := buildGtml(t)
+	output := filepath.Join(t.TempDir(), "output")
+
+	runGtml(t, gtml, ".", "--out-dir", "build", "./test/good_components", output, "main")
+	for _, name := range []string{"gtml_helpers.go", "GreetingCard_gtml.go", "GuestMesh_gtml.go"} {
+		_, err := os.Stat(filepath.Join(output, name))
+		if err != nil {
+			t.Fatalf("expected %s to be generated: %s", name, err)
+		}
+	}
+
+	cmd := gtmlCommand(gtml, ".", "--check", "--out-dir", "build", "./test/good_components", output, "main")
+	cmd.Stderr = os.Stderr
 	err := cmd.Run()
+	if err != nil {
+		t.Fatalf("--check failed on a freshly built directory: %s", err)
+	}
+}
+
+func TestRuntime(t *testing.T) {
+	gtml := buildGtml(t)
+	path := filepath.Join(t.TempDir(), "output.go")
+
+	runGtml(t, gtml, ".", "--runtime", "build", "./test/good_components", path, "main")
+	output, err := os.ReadFile(path)
 	if err != nil {
 		t.Fatalf("Error: %s", err)
 	}
+	if !strings.Contains(string(output), `gtml "github.com/phillip-england/gtml/runtime"`) {
+		t.Fatalf("expected output to import gtml/runtime")
+	}
+	if strings.Contains(string(output), "func gtmlFor") {
+		t.Fatalf("expected helpers to be left out of the output")
+	}
+	if !strings.Contains(string(output), "gtml.For(") {
+		t.Fatalf("expected _for to call gtml.For")
+	}
+	if !strings.Contains(string(output), `gtmlmd "github.com/phillip-england/gtml/runtime/md"`) || strings.Contains(string(output), "func gtmlMd") {
+		t.Fatalf("expected _md to call the runtime/md package")
+	}
+	if !strings.Contains(string(output), `gtmlmd.Render(`) {
+		t.Fatalf("expected _md to call gtmlmd.Render")
+	}
 
-	cmd = exec.Command("./main", "build", "./test/good_components", "./output.go", "main")
-	cmd.Stdout = os.Stdout
+	// a project outside of this repo imports the runtime by its module path
+	repo, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module site\n\ngo 1.23.3\n\nrequire github.com/phillip-england/gtml v0.0.0\n\nreplace github.com/phillip-england/gtml => " + repo + "\n",
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(List([]string{"a", "<b>"}))
+}`,
+		"components/list.html": `<ul _component="List"><li _for="item of items []string">$val(item)</li></ul>`,
+	})
+	runGtml(t, gtml, dir, "--runtime", "build", "./components", "./list_gtml.go", "main")
+	want := `<ul _component="List" _id="0"><li _for="item of items []string" _id="1">a</li><li _for="item of items []string" _id="1">&lt;b&gt;</li></ul>
+`
+	if got := runGo(t, dir); got != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	gtml := buildGtml(t)
+
+	src, err := os.ReadFile("./test/good_components/RuneProp.html")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"components/RuneProp.html": string(src),
+		"gtml.toml": `
+[[targets]]
+input = "./components"
+output = "./site/site.go"
+package = "site"
+
+[[targets]]
+input = "./components"
+output = "./raw/raw.go"
+package = "raw"
+escape = "none"
+`,
+	})
+	runGtml(t, gtml, dir, "--no-cache", "build")
+
+	site, err := os.ReadFile(filepath.Join(dir, "site", "site.go"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !strings.Contains(string(site), "WriteString(gtmlEscape(name))") {
+		t.Fatalf("expected the site target to escape values")
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "raw", "raw.go"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if strings.Contains(string(raw), "WriteString(gtmlEscape(") {
+		t.Fatalf("expected the raw target to write values unescaped")
+	}
+}
+
+func TestFlags(t *testing.T) {
+	gtml := buildGtml(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "output.go")
+
+	runGtml(t, gtml, ".", "build", "./test/good_components", "--no-cache", path, "--escape=none", "main", "--md-theme", "nord")
+	output, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if strings.Contains(string(output), "WriteString(gtmlEscape(") {
+		t.Fatalf("expected --escape=none to write values unescaped")
+	}
+
+	// an _md element without _md-theme is given the theme of --md-theme
+	writeFiles(t, dir, map[string]string{
+		"components/Notes.html": `<div _component="Notes"><div _md="/notes.md"></div></div>`,
+	})
+	runGtml(t, gtml, dir, "build", "./components", "./output.go", "main", "--md-theme", "nord")
+	output, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !strings.Contains(string(output), `gtmlMd("/notes.md", "nord")`) {
+		t.Fatalf("expected --md-theme nord to set the theme of _md elements without one")
+	}
+
+	err = gtmlCommand(gtml, ".", "build", "--no-such-flag", "./test/good_components", path, "main").Run()
+	if err == nil {
+		t.Fatalf("expected an unknown flag to fail")
+	}
+}
+
+func TestPaths(t *testing.T) {
+	gtml := buildGtml(t)
+
+	input, err := filepath.Abs("./test/good_components")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	dir := t.TempDir()
+	output := filepath.Join(dir, "v1.2", "views.go")
+	runGtml(t, gtml, dir, "build", "--no-cache", input, output, "views")
+	_, err = os.Stat(output)
+	if err != nil {
+		t.Fatalf("expected %s to be generated: %s", output, err)
+	}
+
+	err = gtmlCommand(gtml, dir, "build", "./no_such_dir", "./output.go", "main").Run()
+	if err == nil {
+		t.Fatalf("expected a missing input directory to fail")
+	}
+}
+
+func TestGoGenerate(t *testing.T) {
+	gtml := buildGtml(t)
+
+	src, err := os.ReadFile("./test/good_components/RuneProp.html")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"templates/RuneProp.html": string(src),
+	})
+
+	// go generate runs in the package directory with $GOPACKAGE set
+	cmd := gtmlCommand(gtml, dir, "build", "--no-cache", "./templates")
+	cmd.Env = append(cmd.Env, "GOPACKAGE=views")
 	cmd.Stderr = os.Stderr
 	err = cmd.Run()
 	if err != nil {
 		t.Fatalf("Error: %s", err)
 	}
+	output, err := os.ReadFile(filepath.Join(dir, "templates_gtml.go"))
+	if err != nil {
+		t.Fatalf("expected templates_gtml.go to be generated: %s", err)
+	}
+	if !strings.Contains(string(output), "package views\n") {
+		t.Fatalf("expected the package name to come from $GOPACKAGE")
+	}
+
+	err = gtmlCommand(gtml, dir, "build", "./templates", "./out.go", "my-views").Run()
+	if err == nil {
+		t.Fatalf("expected a package name with a hyphen to fail")
+	}
+}
+
+func TestInputPatterns(t *testing.T) {
+	gtml := buildGtml(t)
+	path := filepath.Join(t.TempDir(), "output.go")
+
+	runGtml(t, gtml, ".", "build", "--no-cache", "./test/good_components/RuneProp.html", path, "main")
+	output, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !strings.Contains(string(output), "func RuneProp(") || strings.Contains(string(output), "func RuneSlot(") {
+		t.Fatalf("expected only the components of RuneProp.html")
+	}
+
+	runGtml(t, gtml, ".", "build", "--no-cache", "./test/**/Rune*.html", path, "main", "--exclude", "RuneSlot.html")
+	output, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !strings.Contains(string(output), "func RuneVal(") {
+		t.Fatalf("expected the glob to match RuneVal.html")
+	}
+	if strings.Contains(string(output), "func RuneSlot(") || strings.Contains(string(output), "func GuestMesh(") {
+		t.Fatalf("expected the glob and --exclude to skip other files")
+	}
+}
+
+func TestFmt(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Messy.html")
+	writeFiles(t, dir, map[string]string{
+		"Messy.html": "<section class=card _component=\"Messy\">\n  <pre>  keep\n    me</pre>\n<p  data-x='a'>Hello, $prop(\"name\")</p></section>",
+	})
+
+	output, err := gtmlCommand(gtml, ".", "fmt", "-l", dir).Output()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if strings.TrimSpace(string(output)) != path {
+		t.Fatalf("expected -l to list %s, got %q", path, output)
+	}
+
+	output, err = gtmlCommand(gtml, ".", "fmt", "-d", path).Output()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !strings.Contains(string(output), "+<section _component=\"Messy\" class=\"card\">") {
+		t.Fatalf("expected -d to show the reordered attributes, got:\n%s", output)
+	}
+	if !strings.Contains(string(output), "-<p  data-x='a'>Hello, $prop(\"name\")</p></section>\n\\ No newline at end of file\n") {
+		t.Fatalf("expected -d to mark the missing final newline, got:\n%s", output)
+	}
+
+	runGtml(t, gtml, ".", "fmt", "-w", path)
+	formatted, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !strings.Contains(string(formatted), "<pre>  keep\n    me</pre>") {
+		t.Fatalf("expected <pre> content to be kept, got:\n%s", formatted)
+	}
+
+	// formatting is idempotent, including over every good component
+	output, err = gtmlCommand(gtml, ".", "fmt", "-l", path).Output()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if len(output) != 0 {
+		t.Fatalf("expected a formatted file to stay formatted, got %q", output)
+	}
+	goodDir := filepath.Join(dir, "good")
+	goodPaths, err := filepath.Glob("./test/good_components/*.html")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	formattedGood := make(map[string]string)
+	for _, goodPath := range goodPaths {
+		once, err := gtmlCommand(gtml, ".", "fmt", goodPath).Output()
+		if err != nil {
+			t.Fatalf("Error formatting %s: %s", goodPath, err)
+		}
+		formattedGood[filepath.Base(goodPath)] = string(once)
+	}
+	writeFiles(t, goodDir, formattedGood)
+	output, err = gtmlCommand(gtml, ".", "fmt", "-l", goodDir).Output()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if len(output) != 0 {
+		t.Fatalf("expected formatting to be idempotent, these changed again:\n%s", output)
+	}
+}
+
+func TestLint(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Problems.html")
+	writeFiles(t, dir, map[string]string{
+		"Problems.html": `<div _component="Page">
+    <Card title="hi" extra="x">
+        <div _slot="footer"><p>f</p></div>
+    </Card>
+    <p>$val(missing)</p>
+    <!-- gtml-lint-ignore undefined-val -->
+    <p>$val(ignored)</p>
+    <ul _for="item of items []string">
+        <li>$val(item)</li>
+    </ul>
+    <div _else="hidden"><p>b</p></div>
+</div>
+
+<div _component="Card">
+    <h1>$prop("title")</h1>
+    <p>$prop("subtitle")</p>
+</div>`,
+	})
+
+	output, err := gtmlCommand(gtml, ".", "lint", dir).Output()
+	if err == nil {
+		t.Fatalf("expected gtml lint to fail when it finds problems")
+	}
+	expected := []string{
+		path + ":2: Card is passed extra but never uses it (unused-prop)",
+		path + ":2: Card needs subtitle, which is not passed to it (missing-prop)",
+		path + `:3: Card never renders the _slot "footer" with $slot("footer") (unused-slot)`,
+		path + ":5: $val(missing) uses missing, which is not a prop, _for or _let variable in scope (undefined-val)",
+		path + `:11: _else="hidden" does not follow an _if="hidden" (else-without-if)`,
+	}
+	if strings.TrimSpace(string(output)) != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected lint output:\n%s", output)
+	}
+
+	output, _ = gtmlCommand(gtml, ".", "lint", "--json", "--disable", "missing-prop", "--disable", "unused-prop", path).Output()
+	if !strings.Contains(string(output), `"rule": "unused-slot"`) || strings.Contains(string(output), `"rule": "missing-prop"`) {
+		t.Fatalf("expected --json to print the enabled rules only, got:\n%s", output)
+	}
+
+	output, err = gtmlCommand(gtml, ".", "lint", "./test/good_components/RuneProp.html").Output()
+	if err != nil || len(output) != 0 {
+		t.Fatalf("expected no problems in RuneProp.html, got %q", output)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	gtml := buildGtml(t)
+
+	output, err := gtmlCommand(gtml, ".", "graph", "./test/good_components/GreetingCard.html").Output()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !strings.Contains(string(output), `"GreetingCard" -> "GreetingSlot" [label="message, loop"];`) {
+		t.Fatalf("expected the placeholder edge with its slots, got:\n%s", output)
+	}
+
+	output, err = gtmlCommand(gtml, ".", "graph", "--unused", "./test/good_components/PlaceholderBasic.html").Output()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if strings.TrimSpace(string(output)) != "PlaceholderBasic" {
+		t.Fatalf("expected only PlaceholderBasic to be unused, got %q", output)
+	}
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"Loop.html": `<div _component="Alpha">
+    <Beta></Beta>
+</div>
+
+<div _component="Beta">
+    <Alpha></Alpha>
+</div>`,
+	})
+	cmd := gtmlCommand(gtml, ".", "graph", "--json", dir)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err = cmd.Output()
+	if err == nil {
+		t.Fatalf("expected gtml graph to fail on a cycle")
+	}
+	if !strings.Contains(stderr.String(), "Alpha -> Beta -> Alpha") {
+		t.Fatalf("expected the cycle to be reported, got:\n%s", stderr.String())
+	}
+	if !strings.Contains(string(output), `"cycles": [`) {
+		t.Fatalf("expected the JSON graph to be printed, got:\n%s", output)
+	}
+
+	// components which all use one another hold a cycle through every
+	// order of them, they are reported as one group without walking each
+	var mesh strings.Builder
+	for i := 0; i < 12; i++ {
+		mesh.WriteString(fmt.Sprintf("<div _component=\"Mesh%c\">\n", 'A'+i))
+		for j := 0; j < 12; j++ {
+			mesh.WriteString(fmt.Sprintf("    <Mesh%c></Mesh%c>\n", 'A'+j, 'A'+j))
+		}
+		mesh.WriteString("</div>\n\n")
+	}
+	meshDir := t.TempDir()
+	writeFiles(t, meshDir, map[string]string{"Mesh.html": mesh.String()})
+	cmd = gtmlCommand(gtml, ".", "graph", meshDir)
+	stderr.Reset()
+	cmd.Stderr = &stderr
+	output, err = cmd.Output()
+	if err == nil {
+		t.Fatalf("expected gtml graph to fail on a cycle")
+	}
+	if !strings.Contains(stderr.String(), "found 1 placeholder cycle(s)") || !strings.Contains(stderr.String(), "MeshA -> MeshA") {
+		t.Fatalf("expected the mesh to be reported as one cycle, got:\n%s", stderr.String())
+	}
+	if !strings.Contains(string(output), `"MeshD" -> "MeshH" [color=red];`) {
+		t.Fatalf("expected every edge of the mesh to be drawn in red, got:\n%s", output)
+	}
+}
+
+func TestLsp(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	guestSrc := `package site
+
+type Guest struct {
+	Name string
+	Age  int
+}
+`
+	files := map[string]string{
+		"go.mod":   "module site\n\ngo 1.23\n",
+		"guest.go": guestSrc,
+		"guests.html": `<div _component="GuestList">
+    <ul _for="guest of guests []Guest">
+        <li>$val(guest.)</li>
+    </ul>
+    <GuestCard ></GuestCard>
+</div>
+
+<div _component="GuestCard">
+    <p>$prop("guestName")</p>
+</div>`,
+	}
+	writeFiles(t, dir, files)
+
+	uri := "file://" + filepath.ToSlash(filepath.Join(dir, "guests.html"))
+	at := func(line int, character int) map[string]any {
+		return map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     map[string]any{"line": line, "character": character},
+		}
+	}
+	msgs := []map[string]any{
+		{"id": 1, "method": "initialize", "params": map[string]any{
+			"rootUri": "file://" + filepath.ToSlash(dir),
+			"capabilities": map[string]any{
+				"workspace": map[string]any{"didChangeWatchedFiles": map[string]any{"dynamicRegistration": true}},
+			},
+		}},
+		{"method": "initialized", "params": map[string]any{}},
+		{"method": "textDocument/didOpen", "params": map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": "html", "version": 1, "text": files["guests.html"]},
+		}},
+		{"id": 2, "method": "textDocument/definition", "params": at(4, 7)},
+		{"id": 3, "method": "textDocument/hover", "params": at(4, 7)},
+		{"id": 4, "method": "textDocument/completion", "params": at(4, 15)},
+		{"id": 5, "method": "textDocument/completion", "params": at(2, 23)},
+	}
+	encode := func(msgs []map[string]any) string {
+		var input strings.Builder
+		for _, msg := range msgs {
+			msg["jsonrpc"] = "2.0"
+			body, err := json.Marshal(msg)
+			if err != nil {
+				t.Fatalf("Error: %s", err)
+			}
+			input.WriteString(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body))
+		}
+		return input.String()
+	}
+
+	cmd := gtmlCommand(gtml, dir, "lsp")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	var output strings.Builder
+	readUntil := func(want string) {
+		buf := make([]byte, 4096)
+		for !strings.Contains(output.String(), want) {
+			n, err := stdout.Read(buf)
+			output.Write(buf[:n])
+			if err != nil {
+				t.Fatalf("expected gtml lsp to reply with %s, got:\n%s", want, output.String())
+			}
+		}
+	}
+	_, err = io.WriteString(stdin, encode(msgs))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	readUntil(`"id":5,`)
+
+	// the structs are kept between completions until the client reports
+	// a Go file changed, or it is saved in the editor
+	err = os.WriteFile(filepath.Join(dir, "guest.go"), []byte(guestSrc+"\ntype Seat struct {\n\tTable int\n}\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	files["guests.html"] = strings.Replace(files["guests.html"], "guest of guests []Guest", "seat of seats []Seat", 1)
+	files["guests.html"] = strings.Replace(files["guests.html"], "$val(guest.)", "$val(seat.)", 1)
+	changed := map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []map[string]any{{"text": files["guests.html"]}},
+	}
+	goUri := "file://" + filepath.ToSlash(filepath.Join(dir, "guest.go"))
+	msgs = []map[string]any{
+		{"id": "gtml-watch-go", "result": nil},
+		{"method": "textDocument/didChange", "params": changed},
+		{"id": 6, "method": "textDocument/completion", "params": at(2, 22)},
+		{"method": "workspace/didChangeWatchedFiles", "params": map[string]any{
+			"changes": []map[string]any{{"uri": goUri, "type": 2}},
+		}},
+		{"id": 7, "method": "textDocument/completion", "params": at(2, 22)},
+	}
+	_, err = io.WriteString(stdin, encode(msgs))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	readUntil(`"id":7,`)
+
+	err = os.WriteFile(filepath.Join(dir, "guest.go"), []byte(guestSrc+"\ntype Seat struct {\n\tTable int\n\tColor string\n}\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	msgs = []map[string]any{
+		{"method": "textDocument/didSave", "params": map[string]any{"textDocument": map[string]any{"uri": goUri}}},
+		{"id": 8, "method": "textDocument/completion", "params": at(2, 22)},
+		{"id": 9, "method": "shutdown"},
+		{"method": "exit"},
+	}
+	_, err = io.WriteString(stdin, encode(msgs))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	readUntil(`"id":9,`)
+	stdin.Close()
+	err = cmd.Wait()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	out := output.String()
+	if strings.Contains(out[strings.Index(out, `"id":6,`):strings.Index(out, `"id":7,`)], `"label":"Table"`) {
+		t.Fatalf("expected the structs to be kept until guest.go changes, got:\n%s", out)
+	}
+	watched := out[strings.Index(out, `"id":7,`):strings.Index(out, `"id":8,`)]
+	if !strings.Contains(watched, `"label":"Table"`) || strings.Contains(watched, `"label":"Color"`) {
+		t.Fatalf("expected a watched change to guest.go to read its structs again, got:\n%s", out)
+	}
+	if !strings.Contains(out[strings.Index(out, `"id":8,`):], `"label":"Color"`) {
+		t.Fatalf("expected saving guest.go to read its structs again, got:\n%s", out)
+	}
+
+	expected := []string{
+		`"method":"textDocument/publishDiagnostics"`,
+		`"code":"missing-prop"`,
+		`"id":2,"result":{"uri":"` + uri + `","range":{"start":{"line":7,"character":0}`,
+		"func GuestCard(guestName string) string",
+		`"label":"guest-name"`,
+		`"label":"Name"`,
+		`"label":"Age"`,
+		`"method":"client/registerCapability"`,
+		`"globPattern":"**/*.go"`,
+		`"id":9,"result":null`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected gtml lsp to reply with %s, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestCtx(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module site\n\ngo 1.23\n",
+		"main.go": `package main
+
+import (
+	"context"
+	"fmt"
+)
+
+func main() {
+	ctx := context.WithValue(context.Background(), gtmlKey("user"), "<ann>")
+	fmt.Print(Page(ctx, "Home"))
+	ctx = context.WithValue(context.Background(), "user", "plain")
+	fmt.Print(UserBadge(ctx))
+	fmt.Print(UserBadge(nil))
+}
+`,
+		"components/page.html": `<div _component="Page">
+    <h1>$prop("title")</h1>
+    <Menu></Menu>
+</div>
+
+<div _component="Menu">
+    <UserBadge></UserBadge>
+</div>
+
+<span _component="UserBadge">$ctx("user")$ctx("missing")</span>`,
+	}
+	writeFiles(t, dir, files)
+
+	runGtml(t, gtml, dir, "build", "./components", "./page_gtml.go", "main")
+	generated, err := os.ReadFile(filepath.Join(dir, "page_gtml.go"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	for _, want := range []string{"func Menu(ctx context.Context) string", "return UserBadge(ctx)"} {
+		if !strings.Contains(string(generated), want) {
+			t.Fatalf("expected the context to be passed through placeholders, missing %q in:\n%s", want, generated)
+		}
+	}
+
+	output := runGo(t, dir)
+	if !strings.Contains(output, `<span _component="UserBadge" _id="0">&lt;ann&gt;</span>`) {
+		t.Fatalf("expected $ctx to read and escape the value from the context, got:\n%s", output)
+	}
+	if strings.Contains(output, "plain") {
+		t.Fatalf("expected $ctx to only read values stored under gtmlKey, got:\n%s", output)
+	}
+	if strings.Count(output, `<span _component="UserBadge" _id="0"></span>`) != 2 {
+		t.Fatalf("expected $ctx to write nothing for a plain string key or a nil context, got:\n%s", output)
+	}
+
+	// a handler outside the package holding the components sets the value
+	dir = t.TempDir()
+	files = map[string]string{
+		"go.mod": "module site\n\ngo 1.23\n",
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"site/handler"
+)
+
+func main() {
+	fmt.Print(handler.Home())
+}
+`,
+		"handler/handler.go": `package handler
+
+import (
+	"context"
+
+	"site/views"
+)
+
+func Home() string {
+	ctx := views.GtmlWithCtx(context.Background(), "user", "Melody")
+	return views.UserBadge(ctx)
+}
+`,
+		"components/badge.html": `<span _component="UserBadge">$ctx("user")</span>`,
+	}
+	writeFiles(t, dir, files)
+
+	runGtml(t, gtml, dir, "build", "./components", "./views/views_gtml.go", "views")
+	output = runGo(t, dir)
+	if !strings.Contains(output, `<span _component="UserBadge" _id="0">Melody</span>`) {
+		t.Fatalf("expected a handler in another package to set the $ctx value, got:\n%s", output)
+	}
+}
+
+func TestLet(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module site\n\ngo 1.23\n",
+		"main.go": `package main
+
+import "fmt"
+
+type Guest struct {
+	FirstName string
+	LastName  string
+}
+
+func main() {
+	fmt.Print(GuestList("guests", []Guest{{"Ann", "Lee"}, {"Bo", "Diaz"}}))
+}`,
+		"components/list.html": `<div _component="GuestList" _let='title = strings.ToUpper(heading); intro := title + "!"; unused = len(heading)'>
+    <h1>$val(intro) $prop("heading")</h1>
+    <ul _for='guest of Guests []Guest' _let='fullName = guest.FirstName + " " + guest.LastName; initial = guest.FirstName[:1]'>
+        <li>$val(fullName) of $val(title)</li>
+    </ul>
+</div>`,
+		"piped/badge.html": `<div _component="Card" _let='greeting = "hi " + name'>
+    <p>$prop("name")</p>
+    <Badge label="$pipe(greeting)"></Badge>
+</div>
+
+<span _component="Badge">$prop("label")</span>`,
+	}
+	writeFiles(t, dir, files)
+
+	runGtml(t, gtml, dir, "build", "./components", "./list_gtml.go", "main")
+	output := runGo(t, dir)
+	for _, want := range []string{"<h1>GUESTS! guests</h1>", "<li>Ann Lee of GUESTS</li>", "<li>Bo Diaz of GUESTS</li>"} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("expected the _let variables to be rendered, missing %q in:\n%s", want, output)
+		}
+	}
+
+	failure, err := gtmlCommand(gtml, dir, "build", "./piped", "./piped_gtml.go", "main").CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected piping a _let variable to fail, got:\n%s", failure)
+	}
+	if !strings.Contains(string(failure), "can not be piped") {
+		t.Fatalf("expected an error about piping a _let variable, got:\n%s", failure)
+	}
+}
+
+func TestCondAttrs(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module site\n\ngo 1.23\n",
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(Toolbar(true, false, true, false))
+	fmt.Println(Toolbar(false, true, false, true))
+}`,
+		"components/toolbar.html": `<div _component="Toolbar">
+    <a href="/" aria-current="page" _attr:aria-current="onHome">home</a>
+    <button class="btn" _class="{ active: isActive, 'text-red': hasError }" _attr:disabled="!canEdit">save</button>
+</div>`,
+	}
+	writeFiles(t, dir, files)
+
+	runGtml(t, gtml, dir, "build", "./components", "./toolbar_gtml.go", "main")
+	generated, err := os.ReadFile(filepath.Join(dir, "toolbar_gtml.go"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !strings.Contains(string(generated), "func Toolbar(onHome bool, canEdit bool, isActive bool, hasError bool) string") {
+		t.Fatalf("expected the conditions to become bool props, got:\n%s", generated)
+	}
+
+	output := runGo(t, dir)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two renders, got:\n%s", output)
+	}
+	want := []string{
+		`<a href="/" aria-current="page">home</a><button disabled class="btn active">save</button>`,
+		`<a href="/">home</a><button class="btn text-red">save</button>`,
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, want[i]) {
+			t.Fatalf("expected %q in render %d, got:\n%s", want[i], i, line)
+		}
+	}
+}
+
+func TestRestAttrs(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module site\n\ngo 1.23\n",
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(Toolbar())
+	fmt.Println(SaveButton("direct", map[string]string{"id": "x"}))
+}`,
+		"components/toolbar.html": `<div _component="Toolbar">
+    <SaveButton label="save" class="w-full" data-testid="save" type="submit"></SaveButton>
+    <SaveButton label="plain"></SaveButton>
+</div>
+
+<button _component="SaveButton" class="btn" type="button" _class="{ wide: true }" _rest>$prop("label")</button>`,
+	}
+	writeFiles(t, dir, files)
+
+	runGtml(t, gtml, dir, "build", "./components", "./toolbar_gtml.go", "main")
+	generated, err := os.ReadFile(filepath.Join(dir, "toolbar_gtml.go"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if !strings.Contains(string(generated), "func SaveButton(label string, attrs map[string]string) string") {
+		t.Fatalf("expected _rest to add an attrs param, got:\n%s", generated)
+	}
+
+	output := runGo(t, dir)
+	want := []string{
+		`type="button" _id="0" class="btn wide w-full" data-testid="save">save</button>`,
+		`type="button" _id="0" class="btn wide">plain</button>`,
+		`type="button" _id="0" class="btn wide" id="x">direct</button>`,
+	}
+	for _, w := range want {
+		if !strings.Contains(output, w) {
+			t.Fatalf("expected the passed attributes to be spread, missing %q in:\n%s", w, output)
+		}
+	}
+	if strings.Contains(output, "label=") {
+		t.Fatalf("expected props to be left out of the spread attributes, got:\n%s", output)
+	}
+}
+
+func TestSlotDefaults(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module site\n\ngo 1.23\n",
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(HomePage())
+	fmt.Println(DocsPage())
+}`,
+		"components/layout.html": `<div _component="Layout">
+    <main>$slot("children")</main>
+    <nav _slot-default="sidebar"><p>default nav</p></nav>
+    <footer>$slot("footer")</footer>
+</div>
+
+<Layout _component="HomePage">
+    <p>home</p>
+</Layout>
+
+<Layout _component="DocsPage">
+    <ul _slot="sidebar"><li>toc</li></ul>
+    <p>docs</p>
+</Layout>`,
+	}
+	writeFiles(t, dir, files)
+
+	runGtml(t, gtml, dir, "build", "./components", "./layout_gtml.go", "main")
+	output := runGo(t, dir)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two renders, got:\n%s", output)
+	}
+	want := []string{
+		`<main><p>home</p></main><nav _slot-default="sidebar" _id="1"><p>default nav</p></nav><footer></footer>`,
+		`<main><p>docs</p></main><ul _slot="sidebar" _id="1"><li>toc</li></ul><footer></footer>`,
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, want[i]) {
+			t.Fatalf("expected %q in render %d, got:\n%s", want[i], i, line)
+		}
+	}
+}
+
+func TestScopedSlots(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module site\n\ngo 1.23\n",
+		"main.go": `package main
+
+import "fmt"
+
+type Guest struct {
+	Name string
+}
+
+type Table []Guest
+
+func main() {
+	tables := []Table{{{Name: "Ann"}, {Name: "Bo"}}}
+	fmt.Println(SeatingChart("Party", tables))
+	fmt.Println(EmptyChart(tables))
+}`,
+		"components/chart.html": `<ul _component="GuestRows">
+    <li _for="guest of guests []Guest">$slot("row", Guest)</li>
+</ul>
+
+<div _component="SeatingChart">
+    <section _for="table of tables []Table">
+        <GuestRows guests="$pipe(table)">
+            <b _slot="row">$val(item.Name) at $prop("title")</b>
+        </GuestRows>
+    </section>
+</div>
+
+<div _component="EmptyChart">
+    <section _for="table of tables []Table">
+        <GuestRows guests="$pipe(table)"></GuestRows>
+    </section>
+</div>`,
+	}
+	writeFiles(t, dir, files)
+
+	runGtml(t, gtml, dir, "build", "./components", "./chart_gtml.go", "main")
+	output := runGo(t, dir)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two renders, got:\n%s", output)
+	}
+	want := []string{
+		`_id="3">Ann at Party</b></li><li _for="guest of guests []Guest" _id="1"><b _slot="row" _id="3">Bo at Party</b></li>`,
+		`<li _for="guest of guests []Guest" _id="1"></li><li _for="guest of guests []Guest" _id="1"></li>`,
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, want[i]) {
+			t.Fatalf("expected %q in render %d, got:\n%s", want[i], i, line)
+		}
+	}
+	if strings.Contains(output, "_slot-type") {
+		t.Fatalf("expected _slot-type to be left out of the rendered html, got:\n%s", output)
+	}
+
+	// a scoped slot outside of a _for over its type has no item to pass
+	writeFiles(t, dir, map[string]string{
+		"components/chart.html": `<div _component="GuestRows">$slot("row", Guest)</div>`,
+	})
+	failure, err := gtmlCommand(gtml, dir, "build", "./components", "./chart_gtml.go", "main").CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected the build to fail, got:\n%s", failure)
+	}
+	if !strings.Contains(string(failure), "outside of a _for over []Guest") {
+		t.Fatalf("expected a scoped slot error, got:\n%s", failure)
+	}
+}
+
+func TestDocumentLayouts(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module site\n\ngo 1.23\n",
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(HomePage())
+	fmt.Println(Card())
+}`,
+		"components/layout.html": `<html _component="Layout" lang="en">
+    <head>
+        <meta charset="UTF-8" />
+        <title _head>$prop("siteName")</title>
+        <meta _head name="description" content="a site" />
+    </head>
+    <body>
+        $slot("children")
+    </body>
+</html>
+
+<Layout _component="HomePage" site-name="Site">
+    <title _head>Home</title>
+    <p>home</p>
+    <Card></Card>
+    <Card></Card>
+</Layout>
+
+<div _component="Card">
+    <link _head rel="stylesheet" href="/card.css" />
+    <p>card</p>
+</div>`,
+	}
+	writeFiles(t, dir, files)
+
+	runGtml(t, gtml, dir, "build", "./components", "./layout_gtml.go", "main")
+	output := runGo(t, dir)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two renders, got:\n%s", output)
+	}
+	// the page title wins over the layout's and the card's link is
+	// written once however many cards there are
+	want := []string{
+		`<!DOCTYPE html><html _component="Layout" lang="en" _id="0"><head><meta charset="UTF-8"/><title>Home</title><meta name="description" content="a site"/><link rel="stylesheet" href="/card.css"/></head><body><p>home</p><div _component="Card" _id="0"><p>card</p></div><div _component="Card" _id="0"><p>card</p></div></body></html>`,
+		`<div _component="Card" _id="0"><link _head="" rel="stylesheet" href="/card.css"/><p>card</p></div>`,
+	}
+	for i, line := range lines {
+		if line != want[i] {
+			t.Fatalf("expected render %d to be:\n%s\ngot:\n%s", i, want[i], line)
+		}
+	}
+
+	// _head is only for the elements which belong in a <head>
+	writeFiles(t, dir, map[string]string{
+		"components/layout.html": `<div _component="Card"><p _head>card</p></div>`,
+	})
+	failure, err := gtmlCommand(gtml, dir, "build", "./components", "./layout_gtml.go", "main").CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected the build to fail, got:\n%s", failure)
+	}
+	if !strings.Contains(string(failure), "does not belong in a <head>") {
+		t.Fatalf("expected a _head error, got:\n%s", failure)
+	}
+}
+
+func TestScopedAssets(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module site\n\ngo 1.23\n",
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(CardList())
+	fmt.Print(GtmlStyles())
+	fmt.Print(GtmlScripts())
+}`,
+		"components/card.html": `<div _component="Card" class="card">
+    <style _scoped>
+        .card h2:hover, p { color: red; }
+        @media (max-width: 600px) {
+            p > a::after { content: "}"; }
+        }
+    </style>
+    <script _once>
+        // greets once per page
+        console.log("card")
+    </script>
+    <h2>$prop("title")</h2>
+</div>
+
+<div _component="CardList">
+    <Card title="a"></Card>
+    <Card title="b"></Card>
+</div>`,
+	}
+	writeFiles(t, dir, files)
+
+	runGtml(t, gtml, dir, "build", "./components", "./card_gtml.go", "main")
+	output := runGo(t, dir)
+	want := `<div _component="CardList" _id="0"><div _component="Card" class="card gtml-be3702e3" _id="0"><h2 class="gtml-be3702e3">a</h2></div><div _component="Card" class="card gtml-be3702e3" _id="0"><h2 class="gtml-be3702e3">b</h2></div></div>
+.card h2.gtml-be3702e3:hover, p.gtml-be3702e3 { color: red; }
+@media (max-width: 600px) {
+p > a.gtml-be3702e3::after { content: "}"; }
+}
+// greets once per page
+console.log("card")
+`
+	if output != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, output)
+	}
+
+	// _scoped is only for a <style>
+	writeFiles(t, dir, map[string]string{
+		"components/card.html": `<div _component="Card"><p _scoped>card</p></div>`,
+	})
+	failure, err := gtmlCommand(gtml, dir, "build", "./components", "./card_gtml.go", "main").CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected the build to fail, got:\n%s", failure)
+	}
+	if !strings.Contains(string(failure), "_scoped found on a <p>") {
+		t.Fatalf("expected a _scoped error, got:\n%s", failure)
+	}
+}
+
+func TestFragments(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module site\n\ngo 1.23\n",
+		"main.go": `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Guest struct {
+	Name string
+	Seat string
+}
+
+func main() {
+	guests := []Guest{{"Ada", "1"}, {"Bo", "2"}}
+	table := GuestTable("Wedding", guests, true)
+	row := GuestRow(guests[1], "Wedding", true)
+	fmt.Println(row)
+	fmt.Println(GuestName(guests[0], "Wedding"))
+	fmt.Println(strings.Contains(table, row))
+}`,
+		"components/table.html": `<table _component="GuestTable" _let="heading := strings.ToUpper(title)">
+    <caption>$prop("title")</caption>
+    <tr _for="guest of guests []Guest" _fragment="GuestRow">
+        <td _fragment="GuestName">$val(heading): $val(guest.Name)</td>
+        <td _if="showSeat">$val(guest.Seat)</td>
+    </tr>
+</table>`,
+	}
+	writeFiles(t, dir, files)
+
+	runGtml(t, gtml, dir, "build", "./components", "./table_gtml.go", "main")
+	output := runGo(t, dir)
+	want := `<tr _for="guest of guests []Guest" _fragment="GuestRow" _id="1"><td _fragment="GuestName">WEDDING: Bo</td><td _if="showSeat" _id="2">2</td></tr>
+<td _fragment="GuestName">WEDDING: Ada</td>
+true
+`
+	if output != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, output)
+	}
+
+	// a fragment may not share the name of a component
+	writeFiles(t, dir, map[string]string{
+		"components/table.html": `<table _component="GuestTable"><tr _fragment="GuestTable"><td>guest</td></tr></table>`,
+	})
+	failure, err := gtmlCommand(gtml, dir, "build", "./components", "./table_gtml.go", "main").CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected the build to fail, got:\n%s", failure)
+	}
+	if !strings.Contains(string(failure), "more than one _component or _fragment named GuestTable") {
+		t.Fatalf("expected a duplicate name error, got:\n%s", failure)
+	}
+}
+
+func TestMinify(t *testing.T) {
+	gtml := buildGtml(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module site\n\ngo 1.23\n",
+		"main.go": `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(Page([]string{"a", "b"}))
+}`,
+		"components/page.html": `<div _component="Page">
+    <!-- a comment -->
+    <h1>Hello   <em>big</em>   world</h1>
+    <pre>
+  line one
+     line two
+</pre>
+    <p>
+        some text
+        over lines <b>bold</b> <i>it</i>
+    </p>
+    <ul>
+        <li _for="item of items []string">
+            $val(item)
+        </li>
+    </ul>
+    <script>
+        // greet the visitor
+        console.log("hi")
+    </script>
+</div>`,
+	}
+	writeFiles(t, dir, files)
+
+	run := func(args ...string) string {
+		runGtml(t, gtml, dir, append(args, "build", "./components", "./page_gtml.go", "main")...)
+		return runGo(t, dir)
+	}
+
+	want := `<div _component="Page" _id="0"><h1>Hello <em>big</em> world</h1><pre>  line one&#10;     line two&#10;</pre><p>some text over lines <b>bold</b> <i>it</i></p><ul><li _for="item of items []string" _id="1">a</li><li _for="item of items []string" _id="1">b</li></ul><script>
+// greet the visitor
+console.log("hi")
+</script></div>
+`
+	output := run("--minify")
+	if output != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, output)
+	}
+
+	// the cache of a minified build is not used by a build without it
+	output = run()
+	if !strings.Contains(output, "<!-- a comment -->") {
+		t.Fatalf("expected the comment to be kept without --minify, got:\n%s", output)
+	}
+	output = run("--minify")
+	if output != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, output)
+	}
 }
@@ -0,0 +1,114 @@
+// Package md renders the markdown files of _md elements for gtml
+// generated code.
+//
+// Generated files import it when gtml is run with --runtime and a
+// component has an _md element:
+//
+//	import gtmlmd "github.com/phillip-england/gtml/runtime/md"
+//
+// It is kept apart from the runtime package so only packages using _md
+// depend on goldmark, chroma and goquery.
+package md
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/parser"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// DefaultTheme is the chroma style code blocks are highlighted with when
+// no theme is given.
+const DefaultTheme = "dracula"
+
+// Render converts the markdown file at mdPath into html, highlighting its
+// code blocks with theme. The path is relative to the working directory.
+func Render(mdPath string, theme string) string {
+	if theme == "" {
+		theme = DefaultTheme
+	}
+	if len(mdPath) == 0 {
+		fmt.Println("_md elements require a valid path")
+		return ""
+	}
+	if mdPath[0] != '.' {
+		mdPath = "." + mdPath
+	}
+	mdFileContent, _ := os.ReadFile(mdPath)
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			highlighting.NewHighlighting(
+				highlighting.WithStyle(theme),
+				highlighting.WithFormatOptions(
+					chromahtml.WithLineNumbers(true),
+				),
+			),
+		),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+		),
+		goldmark.WithRendererOptions(
+			goldmarkhtml.WithHardWraps(),
+			goldmarkhtml.WithXHTML(),
+			goldmarkhtml.WithUnsafe(),
+		),
+	)
+	var buf bytes.Buffer
+	_ = md.Convert(mdFileContent, &buf)
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(buf.String()))
+	doc.Find("*").Each(func(i int, inner *goquery.Selection) {
+		style := getStyle(inner)
+		if style == "" {
+			return
+		}
+		currentStyle, _ := inner.Attr("style")
+		inner.SetAttr("style", currentStyle+style)
+	})
+	modifiedHTML, _ := doc.Html()
+	return modifiedHTML
+}
+
+// getStyle returns the inline style given to an element of the rendered
+// markdown.
+func getStyle(inner *goquery.Selection) string {
+	switch goquery.NodeName(inner) {
+	case "pre":
+		return "padding: 1rem; font-size: 0.875rem; overflow-x: auto; border-radius: 0.25rem; margin-bottom: 1rem;"
+	case "h1":
+		return "font-weight: bold; font-size: 1.875rem; padding-bottom: 1rem;"
+	case "h2":
+		return "font-size: 1.5rem; font-weight: bold; padding-bottom: 1rem; padding-top: 0.5rem; border-top-width: 1px; border-top-style: solid; border-color: #1f2937; padding-top: 1rem;"
+	case "h3":
+		return "font-size: 1.25rem; font-weight: bold; margin-top: 1.5rem; margin-bottom: 1rem;"
+	case "p":
+		return "font-size: 0.875rem; line-height: 1.5; margin-bottom: 1rem;"
+	case "ul":
+		return "padding-left: 1.5rem; margin-bottom: 1rem; list-style-type: disc;"
+	case "ol":
+		return "padding-left: 1.5rem; margin-bottom: 1rem; list-style-type: decimal;"
+	case "li":
+		return "margin-bottom: 0.5rem;"
+	case "blockquote":
+		return "margin-left: 1rem; padding-left: 1rem; border-left: 4px solid #ccc; font-style: italic; color: #555;"
+	case "code":
+		// code blocks are styled by their <pre>
+		if goquery.NodeName(inner.Parent()) == "pre" {
+			return ""
+		}
+		return "font-family: monospace; background-color: #1f2937; padding: 0.25rem 0.5rem; border-radius: 0.25rem;"
+	case "hr":
+		return "border: none; border-top: 1px solid #ccc; margin: 2rem 0;"
+	case "a":
+		return "color: #007BFF; text-decoration: none;"
+	case "img":
+		return "max-width: 100%; height: auto; border-radius: 0.25rem; margin: 1rem 0;"
+	}
+	return ""
+}
@@ -0,0 +1,9 @@
+package md
+
+import _ "embed"
+
+// Source is the source of Render and the code it relies on. gtml writes
+// it into generated files which do not import the package.
+//
+//go:embed md.go
+var Source string
@@ -0,0 +1,237 @@
+// Package runtime holds the helpers called by gtml generated code.
+//
+// Generated files import it when gtml is run with --runtime:
+//
+//	import gtml "github.com/phillip-england/gtml/runtime"
+//
+// Without --runtime the same helpers are written into every output file
+// under the names gtmlFor, gtmlIf, gtmlElse, gtmlSlot, gtmlEscape,
+// gtmlCtx, gtmlKey, gtmlAttr, gtmlClass, gtmlRest and gtmlDocument, along
+// with GtmlWithCtx which is exported for other packages to call. _md
+// elements are rendered by the runtime/md package.
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	// very large buffers are dropped so one huge page does not pin memory
+	if buf.Cap() > 64<<10 {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// For calls callback for every item in slice and joins the results.
+func For[T any](slice []T, callback func(i int, item T) string) string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	for i, item := range slice {
+		buf.WriteString(callback(i, item))
+	}
+	return buf.String()
+}
+
+// If returns the result of fn when condition is true.
+func If(condition bool, fn func() string) string {
+	if condition {
+		return fn()
+	}
+	return ""
+}
+
+// Else returns the result of fn when condition is false.
+func Else(condition bool, fn func() string) string {
+	if !condition {
+		return fn()
+	}
+	return ""
+}
+
+// Slot returns the content of a _slot element.
+func Slot(contentFunc func() string) string {
+	return contentFunc()
+}
+
+// Escape escapes a $prop or $val value before it is written into html.
+func Escape(input string) string {
+	return html.EscapeString(input)
+}
+
+// Key is the type of the context keys read by $ctx, so they never clash
+// with the keys of other packages:
+//
+//	ctx = context.WithValue(ctx, gtml.Key("user"), "Melody")
+type Key string
+
+// Ctx returns the value stored under Key(key) in ctx, as read by
+// $ctx("key"), or an empty string when there is none or ctx is nil.
+func Ctx(ctx context.Context, key string) string {
+	if ctx == nil {
+		return ""
+	}
+	value := ctx.Value(Key(key))
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// WithCtx returns a copy of ctx which holds value under Key(key), for
+// $ctx("key") to read. Output files written without --runtime carry it
+// as GtmlWithCtx, so packages other than the one holding the components
+// can set values too.
+func WithCtx(ctx context.Context, key string, value any) context.Context {
+	return context.WithValue(ctx, Key(key), value)
+}
+
+// Attr returns attr when condition is true, as written for an
+// _attr:name="condition" attribute or an entry of _class.
+func Attr(condition bool, attr string) string {
+	if condition {
+		return attr
+	}
+	return ""
+}
+
+// Class writes a class attribute holding the classes which are not
+// empty, or nothing when they all are.
+func Class(classes ...string) string {
+	names := make([]string, 0, len(classes))
+	for _, class := range classes {
+		if class != "" {
+			names = append(names, class)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return " class=\"" + html.EscapeString(strings.Join(names, " ")) + "\""
+}
+
+// Rest writes the attributes passed to a component with _rest, in order
+// of their name. class is left to Class, and the names in skip are left
+// out as the element already has them.
+func Rest(attrs map[string]string, skip ...string) string {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		if key != "class" && !slices.Contains(skip, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	for _, key := range keys {
+		buf.WriteString(" " + key + "=\"" + html.EscapeString(attrs[key]) + "\"")
+	}
+	return buf.String()
+}
+
+// Document finishes the page rendered by a _component whose root is
+// <html>. It writes the doctype and moves every element marked _head
+// into the <head>. Elements which say the same thing, such as two
+// <title>s or two <meta name="description">s, are written once, and the
+// one rendered last wins, so a page overrides its layout.
+func Document(page string) string {
+	heads := make([]string, 0)
+	seen := make(map[string]int)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	rest := page
+	for {
+		start, end := findHead(rest)
+		if start == -1 {
+			break
+		}
+		buf.WriteString(rest[:start])
+		head := strings.Replace(rest[start:end], ` _head=""`, "", 1)
+		rest = rest[end:]
+		key := headKey(head)
+		if i, ok := seen[key]; ok {
+			heads[i] = head
+			continue
+		}
+		seen[key] = len(heads)
+		heads = append(heads, head)
+	}
+	buf.WriteString(rest)
+	doc := buf.String()
+	if i := strings.Index(doc, "</head>"); i != -1 {
+		doc = doc[:i] + strings.Join(heads, "") + doc[i:]
+	}
+	return "<!DOCTYPE html>" + doc
+}
+
+// findHead returns where the first element marked _head in s starts and
+// ends, or -1 when there is none.
+func findHead(s string) (int, int) {
+	mark := strings.Index(s, ` _head=""`)
+	if mark == -1 {
+		return -1, -1
+	}
+	start := strings.LastIndex(s[:mark], "<")
+	tagEnd := strings.Index(s[mark:], ">")
+	if start == -1 || tagEnd == -1 {
+		return -1, -1
+	}
+	end := mark + tagEnd + 1
+	name := strings.Fields(s[start+1 : mark+1])[0]
+	if name == "meta" || name == "link" || name == "base" {
+		return start, end
+	}
+	closeTag := "</" + name + ">"
+	if i := strings.Index(s[end:], closeTag); i != -1 {
+		end += i + len(closeTag)
+	}
+	return start, end
+}
+
+// headKey returns what an element moved into the <head> is told apart
+// from the others by.
+func headKey(head string) string {
+	name := head[1:strings.IndexAny(head, " />")]
+	switch name {
+	case "title", "base":
+		return name
+	case "meta":
+		for _, attr := range []string{"charset", "name", "property", "http-equiv"} {
+			if value, ok := headAttr(head, attr); ok {
+				return name + " " + attr + "=" + value
+			}
+		}
+	case "link":
+		if rel, _ := headAttr(head, "rel"); rel == "canonical" {
+			return name + " " + rel
+		}
+	}
+	return head
+}
+
+// headAttr returns the value of attr in the start tag of head.
+func headAttr(head string, attr string) (string, bool) {
+	tag := head[:strings.Index(head, ">")]
+	i := strings.Index(tag, " "+attr+`="`)
+	if i == -1 {
+		return "", false
+	}
+	value := tag[i+len(attr)+3:]
+	return value[:strings.Index(value, `"`)], true
+}
@@ -0,0 +1,10 @@
+package runtime
+
+import _ "embed"
+
+// Source is the source of the helpers in this package. gtml writes them
+// into generated files which do not import the package, so both are
+// always the same code.
+//
+//go:embed runtime.go
+var Source string
@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// KeyCacheVersion is bumped whenever the on-disk layout changes.
+const KeyCacheVersion = "1"
+
+// Cache maps every source file to the components it produced.
+// Files carry a content hash so unchanged files skip parsing entirely,
+// and components carry their placeholder dependencies so a change to one
+// component only regenerates the components which use it.
+type Cache struct {
+	Path        string `json:"-"`
+	Version     string
+	Fingerprint string
+	Files       map[string]*File
+}
+
+type File struct {
+	Hash       string
+	Components []*Component
+}
+
+type Component struct {
+	Name    string
+	SrcHash string
+	Key     string
+	Deps    []string
+	Params  []string
+	Data    string
+}
+
+func NewCache(path string, fingerprint string) (*Cache, error) {
+	c := &Cache{
+		Path:        path,
+		Version:     KeyCacheVersion,
+		Fingerprint: fingerprint,
+		Files:       make(map[string]*File),
+	}
+	if path == "" {
+		return c, nil
+	}
+	f, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	onDisk := &Cache{}
+	err = json.Unmarshal(f, onDisk)
+	if err != nil {
+		return c, nil // a corrupt cache is rebuilt from scratch
+	}
+	if onDisk.Version != c.Version || onDisk.Fingerprint != c.Fingerprint || onDisk.Files == nil {
+		return c, nil
+	}
+	c.Files = onDisk.Files
+	return c, nil
+}
+
+func (c *Cache) GetFile(path string) *File       { return c.Files[path] }
+func (c *Cache) SetFile(path string, file *File) { c.Files[path] = file }
+func (c *Cache) Print()                          { fmt.Println(c.Path) }
+
+// Prune drops every file which is not in paths, returning the dropped paths.
+func (c *Cache) Prune(paths []string) []string {
+	dropped := make([]string, 0)
+	for path := range c.Files {
+		if !containsStr(paths, path) {
+			dropped = append(dropped, path)
+		}
+	}
+	sort.Strings(dropped)
+	for _, path := range dropped {
+		delete(c.Files, path)
+	}
+	return dropped
+}
+
+func (c *Cache) Save() error {
+	if c.Path == "" {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(c.Path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	// write then rename so an interrupted build never leaves a torn cache
+	tmp := c.Path + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	return os.Rename(tmp, c.Path)
+}
+
+func (comp *Component) IsFresh(key string) bool { return comp.Key == key }
+
+func (f *File) GetComponent(name string) *Component {
+	if f == nil {
+		return nil
+	}
+	for _, comp := range f.Components {
+		if comp.Name == name {
+			return comp
+		}
+	}
+	return nil
+}
+
+// Hash returns a hex sha256 of the provided strings.
+func Hash(strs ...string) string {
+	h := sha256.New()
+	for _, s := range strs {
+		io.WriteString(h, s)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Fingerprint identifies the running gtml binary so a cache written by
+// a different build of the compiler is never reused.
+func Fingerprint(settings ...string) string {
+	exe, err := os.Executable()
+	if err != nil {
+		return Hash(settings...)
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return Hash(settings...)
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return Hash(settings...)
+	}
+	return Hash(append([]string{hex.EncodeToString(h.Sum(nil))}, settings...)...)
+}
+
+// DefaultPath places the cache in the user cache dir, keyed by the
+// absolute input and output paths of the build.
+func DefaultPath(input string, output string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	absInput, err := filepath.Abs(input)
+	if err != nil {
+		return "", err
+	}
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return "", err
+	}
+	name := Hash(absInput, absOutput)[:16] + ".json"
+	return filepath.Join(dir, "gtml", name), nil
+}
+
+func containsStr(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
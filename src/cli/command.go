@@ -1,24 +1,37 @@
 package cli
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"go/parser"
+	"go/token"
 	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/config"
+	"github.com/phillip-england/gtml/src/lint"
+	"github.com/phillip-england/gtml/src/source"
 	"github.com/phillip-england/purse"
 )
 
 // ##==================================================================
 const (
 	KeyCommandBuild = "build"
+	KeyCommandFmt   = "fmt"
+	KeyCommandLint  = "lint"
+	KeyCommandGraph = "graph"
+	KeyCommandLsp   = "lsp"
 	KeyCommandHelp  = "help"
 )
 
 // ##==================================================================
 
 func getCommandList() []string {
-	return []string{KeyCommandBuild, KeyCommandHelp}
+	return []string{KeyCommandBuild, KeyCommandFmt, KeyCommandLint, KeyCommandGraph, KeyCommandLsp, KeyCommandHelp}
 }
 
 func errHelp() string {
@@ -41,31 +54,83 @@ func NewCommand() (Command, error) {
 		return nil, nil
 	}
 	args = args[1:]
-	opts := make([]Option, 0)
+
+	// the command may appear anywhere, gtml --watch build ... still works
+	cmdType := ""
+	rest := make([]string, 0)
 	for _, arg := range args {
-		match := purse.FindMatchInStrSlice(getCommandList(), arg)
-		if match == "" {
-			opt, err := NewOption(arg)
-			if err != nil {
-				return nil, err
-			}
-			opts = append(opts, opt)
+		if cmdType == "" && purse.FindMatchInStrSlice(getCommandList(), arg) != "" {
+			cmdType = arg
 			continue
 		}
-		if match == KeyCommandHelp {
-			cmd, err := NewCommandHelp()
-			if err != nil {
-				return nil, err
+		rest = append(rest, arg)
+	}
+	if cmdType == "" {
+		for _, arg := range rest {
+			if arg == "-h" || arg == "--help" || arg == "-help" {
+				return NewCommandHelp([]string{})
 			}
-			return cmd, nil
 		}
-		if match == KeyCommandBuild {
-			cmd, err := NewCommandBuild(opts)
-			if err != nil {
-				return nil, err
-			}
-			return cmd, nil
+		fmt.Println(errHelp())
+		return nil, nil
+	}
+
+	if cmdType == KeyCommandHelp {
+		cmd, err := NewCommandHelp(rest)
+		if err != nil {
+			return nil, err
+		}
+		return cmd, nil
+	}
+	if cmdType == KeyCommandBuild {
+		cmd, err := NewCommandBuild(rest)
+		if errors.Is(err, flag.ErrHelp) {
+			return NewCommandHelp([]string{cmdType})
+		}
+		if err != nil {
+			return nil, err
 		}
+		return cmd, nil
+	}
+	if cmdType == KeyCommandFmt {
+		cmd, err := NewCommandFmt(rest)
+		if errors.Is(err, flag.ErrHelp) {
+			return NewCommandHelp([]string{cmdType})
+		}
+		if err != nil {
+			return nil, err
+		}
+		return cmd, nil
+	}
+	if cmdType == KeyCommandLint {
+		cmd, err := NewCommandLint(rest)
+		if errors.Is(err, flag.ErrHelp) {
+			return NewCommandHelp([]string{cmdType})
+		}
+		if err != nil {
+			return nil, err
+		}
+		return cmd, nil
+	}
+	if cmdType == KeyCommandGraph {
+		cmd, err := NewCommandGraph(rest)
+		if errors.Is(err, flag.ErrHelp) {
+			return NewCommandHelp([]string{cmdType})
+		}
+		if err != nil {
+			return nil, err
+		}
+		return cmd, nil
+	}
+	if cmdType == KeyCommandLsp {
+		cmd, err := NewCommandLsp(rest)
+		if errors.Is(err, flag.ErrHelp) {
+			return NewCommandHelp([]string{cmdType})
+		}
+		if err != nil {
+			return nil, err
+		}
+		return cmd, nil
 	}
 	fmt.Println(errHelp())
 	return nil, nil
@@ -74,22 +139,31 @@ func NewCommand() (Command, error) {
 // ##==================================================================
 type CommandBuild struct {
 	Type         string
+	Args         []string
 	Options      []Option
 	FilteredArgs []string
-	Whitelist    []string
+	MdTheme      string
+	Escape       string
+	Include      []string
+	Exclude      []string
+	Config       *config.Config
 }
 
-func NewCommandBuild(opts []Option) (*CommandBuild, error) {
+func NewCommandBuild(args []string) (*CommandBuild, error) {
 	cmd := &CommandBuild{
-		Type:    KeyCommandBuild,
-		Options: opts,
+		Type: KeyCommandBuild,
+		Args: args,
 	}
 	err := fungi.Process(
+		func() error { return cmd.initFlags() },
 		func() error { return cmd.initFilteredArgs() },
-		func() error { return cmd.initInputWhitelist() },
+		func() error { return cmd.initConfig() },
 		func() error { return cmd.initValidateInputDir() },
+		func() error { return cmd.initDefaultOutputFile() },
 		func() error { return cmd.initValidateOutputFile() },
+		func() error { return cmd.initInferPackageName() },
 		func() error { return cmd.initValidatePackageName() },
+		func() error { return cmd.initValidateTargets() },
 	)
 	if err != nil {
 		return nil, err
@@ -102,170 +176,639 @@ func (cmd *CommandBuild) GetType() string           { return cmd.Type }
 func (cmd *CommandBuild) GetFilteredArgs() []string { return cmd.FilteredArgs }
 func (cmd *CommandBuild) GetOptions() []Option      { return cmd.Options }
 
-func (cmd *CommandBuild) initFilteredArgs() error {
-	filtered := make([]string, 0)
-	for i, arg := range os.Args {
-		if i == 0 {
-			continue
-		}
-		isOpt := false
-		for _, opt := range cmd.Options {
-			if arg == opt.GetType() {
-				isOpt = true
-				continue
-			}
-		}
-		if isOpt {
+// initFlags parses the args of the command, turning bool flags into
+// Options and keeping the values of the rest.
+func (cmd *CommandBuild) initFlags() error {
+	fv, err := parseCommandFlags(cmd.Type, cmd.Args)
+	if err != nil {
+		return err
+	}
+	opts := make([]Option, 0)
+	for _, f := range getCommandFlags(cmd.Type) {
+		if !f.IsBool() || !fv.Bools[f.Name] {
 			continue
 		}
-		if arg == cmd.Type {
-			continue
+		opt, err := NewOption(f.Name)
+		if err != nil {
+			return err
 		}
-		filtered = append(filtered, arg)
+		opts = append(opts, opt)
 	}
-	if len(filtered) != 3 {
+	cmd.Options = opts
+	cmd.FilteredArgs = fv.Positional
+	cmd.MdTheme = fv.Values[KeyFlagMdTheme]
+	cmd.Escape = fv.Values[KeyFlagEscape]
+	cmd.Include = fv.Lists[KeyFlagInclude]
+	cmd.Exclude = fv.Lists[KeyFlagExclude]
+	if cmd.Escape != "" && cmd.Escape != config.KeyEscapeHtml && cmd.Escape != config.KeyEscapeNone {
 		msg := purse.Fmt(`
-gtml build has 3 required args
+invalid %s provided: %s
+use %s or %s
+%s`, KeyFlagEscape, cmd.Escape, config.KeyEscapeHtml, config.KeyEscapeNone, errHelp())
+		return fmt.Errorf(msg)
+	}
+	return nil
+}
+
+func (cmd *CommandBuild) initFilteredArgs() error {
+	if len(cmd.FilteredArgs) > 3 {
+		msg := purse.Fmt(`
+gtml build takes at most 3 args, or none to read gtml.toml / gtml.yaml
 gtml build [INPUT DIR] [OUTPUT FILE] [PACKAGE NAME]
+gtml build --out-dir [INPUT DIR] [OUTPUT DIR] [PACKAGE NAME]
 %s`, errHelp())
 		return fmt.Errorf(msg)
 	}
-	cmd.FilteredArgs = filtered
-
 	return nil
 }
 
-func (cmd *CommandBuild) initInputWhitelist() error {
-	whitelist := make([]string, 0)
-	whitelist = append(whitelist, purse.GetAllLetters()...)
-	whitelist = append(whitelist, purse.GetAllNumbers()...)
-	whitelist = append(whitelist, "-")
-	whitelist = append(whitelist, "_")
-	whitelist = append(whitelist, "/")
-	whitelist = append(whitelist, ".")
-	cmd.Whitelist = whitelist
+// initConfig loads gtml.toml or gtml.yaml from the working directory
+// when gtml build is run without arguments.
+func (cmd *CommandBuild) initConfig() error {
+	if len(cmd.FilteredArgs) != 0 {
+		return nil
+	}
+	path, err := config.FindConfigFile(".")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		msg := purse.Fmt(`
+gtml build has 3 required args, or none to read gtml.toml / gtml.yaml
+no gtml.toml or gtml.yaml found in the current directory
+%s`, errHelp())
+		return fmt.Errorf(msg)
+	}
+	c, err := config.NewConfig(path)
+	if err != nil {
+		return err
+	}
+	cmd.Config = c
 	return nil
 }
 
 func (cmd *CommandBuild) initValidateInputDir() error {
-	inputDir := cmd.FilteredArgs[0]
-	if len(inputDir) == 0 {
-		return fmt.Errorf("gtml build requires an input directory.\n" + errHelp())
+	if cmd.Config != nil {
+		return nil
 	}
-	inputDirFirstChar := string(inputDir[0])
-	if inputDirFirstChar != "." {
-		msg := purse.RemoveFirstLine(fmt.Sprintf(`
-invalid input directory provided: %s
-input directory must start with  '.' like: './path/to/component_dir'
-%s`, inputDir, errHelp()))
-		return fmt.Errorf(msg)
+	return cmd.validateInput(cmd.FilteredArgs[0], cmd.Include, cmd.Exclude)
+}
+
+func (cmd *CommandBuild) initValidateOutputFile() error {
+	if cmd.Config != nil {
+		return nil
 	}
-	if len(inputDir) > 1 {
-		inputDirSecondChar := string(inputDir[1])
-		if inputDirSecondChar != "/" {
-			msg := purse.RemoveFirstLine(fmt.Sprintf(`
-invalid input directory provided: %s
-valid directory example: './path/to/component_dir'
-if you are on windows, you may not use conventional windows directory paths
-%s`, inputDir, errHelp()))
-			return fmt.Errorf(msg)
-		}
+	return cmd.validateOutputFile(cmd.FilteredArgs[1], HasOption(cmd.Options, KeyOptionOutDir))
+}
+
+// initDefaultOutputFile fills in the output when only the input was
+// given, as in //go:generate gtml build ./templates
+func (cmd *CommandBuild) initDefaultOutputFile() error {
+	if cmd.Config != nil || len(cmd.FilteredArgs) != 1 {
+		return nil
 	}
-	if strings.Contains(inputDir, "//") {
-		msg := purse.RemoveFirstLine(fmt.Sprintf(`
-invalid input directory provided: %s
-your input directory contains two '//' characters in a row
-%s`, inputDir, errHelp()))
-		return fmt.Errorf(msg)
+	output := getDefaultOutput(cmd.FilteredArgs[0], HasOption(cmd.Options, KeyOptionOutDir))
+	cmd.FilteredArgs = append(cmd.FilteredArgs, output)
+	return nil
+}
+
+func (cmd *CommandBuild) initInferPackageName() error {
+	if cmd.Config != nil || len(cmd.FilteredArgs) != 2 {
+		return nil
 	}
-	if strings.Count(inputDir, ".") > 1 {
-		msg := purse.RemoveFirstLine(fmt.Sprintf(`
-invalid input directory receieved: %s
-your input directory contains more than one '.'
-only characters, underscores, or hyphens are valid
-%s`, inputDir, errHelp()))
-		return fmt.Errorf(msg)
+	name, err := inferPackageName(cmd.FilteredArgs[1], HasOption(cmd.Options, KeyOptionOutDir))
+	if err != nil {
+		return err
+	}
+	cmd.FilteredArgs = append(cmd.FilteredArgs, name)
+	return nil
+}
+
+func (cmd *CommandBuild) initValidatePackageName() error {
+	if cmd.Config != nil {
+		return nil
+	}
+	return cmd.validatePackageName(cmd.FilteredArgs[2])
+}
+
+// initValidateTargets runs the same checks as the positional args over
+// every target in the config file.
+func (cmd *CommandBuild) initValidateTargets() error {
+	if cmd.Config == nil {
+		return nil
 	}
-	if !purse.EnforeWhitelist(inputDir, cmd.Whitelist) {
+	for _, target := range cmd.Config.Targets {
+		outDir := target.OutDir || HasOption(cmd.Options, KeyOptionOutDir)
+		err := fungi.Process(
+			func() error {
+				return cmd.validateInput(target.Input, append(target.Include, cmd.Include...), append(target.Exclude, cmd.Exclude...))
+			},
+			func() error {
+				if target.Output == "" {
+					target.Output = getDefaultOutput(target.Input, outDir)
+				}
+				return cmd.validateOutputFile(target.Output, outDir)
+			},
+			func() error {
+				if target.Package != "" {
+					return nil
+				}
+				name, err := inferPackageName(target.Output, outDir)
+				if err != nil {
+					return err
+				}
+				target.Package = name
+				return nil
+			},
+			func() error { return cmd.validatePackageName(target.Package) },
+		)
+		if err != nil {
+			return fmt.Errorf("%s: target %s: %w", cmd.Config.Path, target.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateInput checks the input is an existing directory, an .html
+// file, or a glob whose leading directory exists.
+func (cmd *CommandBuild) validateInput(input string, include []string, exclude []string) error {
+	if len(input) == 0 {
+		return fmt.Errorf("gtml build requires an input directory, file, or pattern.\n" + errHelp())
+	}
+	_, err := source.NewInput(input, include, exclude)
+	if err != nil {
 		msg := purse.RemoveFirstLine(fmt.Sprintf(`
-invalid input directory receieved: %s
-only characters, underscores, or hyphens are valid
-%s`, inputDir, errHelp()))
+invalid input provided: %s
+%s
+%s`, input, err.Error(), errHelp()))
 		return fmt.Errorf(msg)
 	}
 	return nil
 }
 
-func (cmd *CommandBuild) initValidateOutputFile() error {
-	outputFile := cmd.FilteredArgs[1]
+func (cmd *CommandBuild) validateOutputFile(outputFile string, outDir bool) error {
+	if outDir {
+		return cmd.validateOutputDir(outputFile)
+	}
 	if len(outputFile) == 0 {
 		return fmt.Errorf("gtml build requires an output file.\n" + errHelp())
 	}
-
-	if !strings.HasSuffix(outputFile, ".go") {
+	if filepath.Ext(outputFile) != ".go" {
 		msg := purse.Fmt(`
 invalid output file provided: %s
 output file must end in '.go'
 %s`, outputFile, errHelp())
 		return fmt.Errorf(msg)
 	}
-	if !strings.HasPrefix(outputFile, "./") {
+	info, err := os.Stat(outputFile)
+	if err == nil && info.IsDir() {
 		msg := purse.RemoveFirstLine(fmt.Sprintf(`
 invalid output file provided: %s
-output file must start with  '.' like: './output.go'
+the path is a directory, use --out-dir to write one file per source file
 %s`, outputFile, errHelp()))
 		return fmt.Errorf(msg)
 	}
-	if strings.Contains(outputFile, "//") {
-		msg := purse.RemoveFirstLine(fmt.Sprintf(`
+	if err != nil && !isMissingPath(err) {
+		return fmt.Errorf("invalid output file provided: %s\n%w", outputFile, err)
+	}
+	if HasOption(cmd.Options, KeyOptionCheck) {
+		return nil // nothing is written
+	}
+	if err == nil {
+		f, err := os.OpenFile(outputFile, os.O_WRONLY, 0)
+		if err != nil {
+			msg := purse.RemoveFirstLine(fmt.Sprintf(`
 invalid output file provided: %s
-youre output file contains two '//' characters in a row
-%s`, outputFile, errHelp()))
+the file can not be written to: %s
+%s`, outputFile, err.Error(), errHelp()))
+			return fmt.Errorf(msg)
+		}
+		f.Close()
+		return nil
+	}
+	return validateWritableDir(filepath.Dir(outputFile), outputFile)
+}
+
+// validateOutputDir checks the output path when --out-dir is set, in
+// which case it names a directory instead of a .go file.
+func (cmd *CommandBuild) validateOutputDir(outputDir string) error {
+	if len(outputDir) == 0 {
+		return fmt.Errorf("gtml build --out-dir requires an output directory.\n" + errHelp())
+	}
+	if filepath.Ext(outputDir) == ".go" {
+		msg := purse.RemoveFirstLine(fmt.Sprintf(`
+invalid output directory provided: %s
+--out-dir expects a directory like: './components', not a .go file
+%s`, outputDir, errHelp()))
 		return fmt.Errorf(msg)
 	}
-	if strings.Count(outputFile, ".") > 2 {
+	info, err := os.Stat(outputDir)
+	if err == nil && !info.IsDir() {
 		msg := purse.RemoveFirstLine(fmt.Sprintf(`
-invalid output file provided: %s
-your output file contains more than two '.' characters
-only characters, underscores, or hyphens are valid
-%s`, outputFile, errHelp()))
+invalid output directory provided: %s
+the path is a file, not a directory
+%s`, outputDir, errHelp()))
 		return fmt.Errorf(msg)
 	}
-	if !purse.EnforeWhitelist(outputFile, cmd.Whitelist) {
+	if err != nil && !isMissingPath(err) {
+		return fmt.Errorf("invalid output directory provided: %s\n%w", outputDir, err)
+	}
+	if HasOption(cmd.Options, KeyOptionCheck) {
+		return nil // nothing is written
+	}
+	return validateWritableDir(outputDir, outputDir)
+}
+
+// isMissingPath reports whether err means the path does not exist,
+// including when one of its parents is a file.
+func isMissingPath(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR)
+}
+
+// validateWritableDir makes sure output can be written below dir. dir
+// may not exist yet, in which case the closest existing parent must be
+// a directory gtml can create files in.
+func validateWritableDir(dir string, output string) error {
+	dir = filepath.Clean(dir)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				msg := purse.RemoveFirstLine(fmt.Sprintf(`
+invalid output provided: %s
+%s is a file, so the output can not be created below it
+%s`, output, dir, errHelp()))
+				return fmt.Errorf(msg)
+			}
+			break
+		}
+		if !isMissingPath(err) {
+			return fmt.Errorf("invalid output provided: %s\n%w", output, err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	f, err := os.CreateTemp(dir, ".gtml-write-check-*")
+	if err != nil {
 		msg := purse.RemoveFirstLine(fmt.Sprintf(`
-invalid output file provided: %s
-only characters, underscores, or hyphens are valid
-%s`, outputFile, errHelp()))
+invalid output provided: %s
+%s is not writable
+%s`, output, dir, errHelp()))
 		return fmt.Errorf(msg)
 	}
+	f.Close()
+	os.Remove(f.Name())
 	return nil
 }
 
-func (cmd *CommandBuild) initValidatePackageName() error {
-	packageName := cmd.FilteredArgs[2]
-	whitelist := purse.GetAllLowerCaseLetters()
-	whitelist = append(whitelist, []string{"-", "_"}...)
-	pass := purse.EnforeWhitelist(packageName, whitelist)
-	if !pass {
+func (cmd *CommandBuild) validatePackageName(packageName string) error {
+	if !token.IsIdentifier(packageName) || packageName == "_" {
 		msg := purse.Fmt(`
 invalid package name provided: %s
-package name may only have lowercase characters, underscores, and hyphens
+package name must be a valid go identifier, such as: views or components
 %s`, packageName, errHelp())
 		return fmt.Errorf(msg)
 	}
 	return nil
 }
 
+// getDefaultOutput is the output used when only the input is given: a
+// <dir>_gtml.go file, or the current directory with --out-dir.
+func getDefaultOutput(input string, outDir bool) string {
+	if outDir {
+		return "."
+	}
+	inputDir := input
+	if source.IsGlob(input) {
+		in, err := source.NewInput(input, nil, nil)
+		if err == nil {
+			inputDir = in.GetRoot()
+		}
+	} else if strings.HasSuffix(input, ".html") {
+		return strings.TrimSuffix(filepath.Base(input), ".html") + "_gtml.go"
+	}
+	name := filepath.Base(filepath.Clean(inputDir))
+	if name == "." || name == string(filepath.Separator) {
+		abs, err := filepath.Abs(inputDir)
+		if err == nil {
+			name = filepath.Base(abs)
+		}
+	}
+	return name + "_gtml.go"
+}
+
+// inferPackageName works out the package of the output when it is not
+// given. go generate sets $GOPACKAGE for the directory it runs in, and
+// any other directory is read from the package clause of its .go files.
+func inferPackageName(output string, outDir bool) (string, error) {
+	dir := filepath.Dir(output)
+	if outDir {
+		dir = output
+	}
+	goPackage := os.Getenv("GOPACKAGE")
+	if goPackage != "" && isWorkingDir(dir) {
+		return strings.TrimSuffix(goPackage, "_test"), nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err != nil {
+			continue
+		}
+		return file.Name.Name, nil
+	}
+	msg := purse.Fmt(`
+unable to infer the package name for: %s
+pass it as the third arg, run gtml from go generate, or add a .go file to %s
+%s`, output, dir, errHelp())
+	return "", fmt.Errorf(msg)
+}
+
+func isWorkingDir(dir string) bool {
+	wd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	return abs == wd
+}
+
+// ##==================================================================
+type CommandFmt struct {
+	Type         string
+	Args         []string
+	Options      []Option
+	FilteredArgs []string
+	List         bool
+	Write        bool
+	Diff         bool
+	Inputs       []*source.Input
+}
+
+func NewCommandFmt(args []string) (*CommandFmt, error) {
+	cmd := &CommandFmt{
+		Type: KeyCommandFmt,
+		Args: args,
+	}
+	err := fungi.Process(
+		func() error { return cmd.initFlags() },
+		func() error { return cmd.initInputs() },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func (cmd *CommandFmt) Print()                    { fmt.Println(cmd.Type) }
+func (cmd *CommandFmt) GetType() string           { return cmd.Type }
+func (cmd *CommandFmt) GetFilteredArgs() []string { return cmd.FilteredArgs }
+func (cmd *CommandFmt) GetOptions() []Option      { return cmd.Options }
+
+func (cmd *CommandFmt) initFlags() error {
+	fv, err := parseCommandFlags(cmd.Type, cmd.Args)
+	if err != nil {
+		return err
+	}
+	cmd.FilteredArgs = fv.Positional
+	cmd.List = fv.Bools[KeyFlagList]
+	cmd.Write = fv.Bools[KeyFlagWrite]
+	cmd.Diff = fv.Bools[KeyFlagDiff]
+	return nil
+}
+
+// initInputs accepts the same directories, files, and globs as
+// gtml build. Without any, gtml fmt reads stdin.
+func (cmd *CommandFmt) initInputs() error {
+	if len(cmd.FilteredArgs) == 0 && (cmd.List || cmd.Write) {
+		msg := purse.Fmt(`
+cannot use %s or %s when formatting stdin
+%s`, KeyFlagList, KeyFlagWrite, errHelp())
+		return fmt.Errorf(msg)
+	}
+	for _, arg := range cmd.FilteredArgs {
+		in, err := source.NewInput(arg, nil, nil)
+		if err != nil {
+			return fmt.Errorf("%s\n%s", err.Error(), errHelp())
+		}
+		cmd.Inputs = append(cmd.Inputs, in)
+	}
+	return nil
+}
+
+// ##==================================================================
+type CommandLint struct {
+	Type         string
+	Args         []string
+	Options      []Option
+	FilteredArgs []string
+	Json         bool
+	Disable      []string
+	Inputs       []*source.Input
+}
+
+func NewCommandLint(args []string) (*CommandLint, error) {
+	cmd := &CommandLint{
+		Type: KeyCommandLint,
+		Args: args,
+	}
+	err := fungi.Process(
+		func() error { return cmd.initFlags() },
+		func() error { return cmd.initDisable() },
+		func() error { return cmd.initInputs() },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func (cmd *CommandLint) Print()                    { fmt.Println(cmd.Type) }
+func (cmd *CommandLint) GetType() string           { return cmd.Type }
+func (cmd *CommandLint) GetFilteredArgs() []string { return cmd.FilteredArgs }
+func (cmd *CommandLint) GetOptions() []Option      { return cmd.Options }
+
+func (cmd *CommandLint) initFlags() error {
+	fv, err := parseCommandFlags(cmd.Type, cmd.Args)
+	if err != nil {
+		return err
+	}
+	cmd.FilteredArgs = fv.Positional
+	cmd.Json = fv.Bools[KeyFlagJson]
+	cmd.Disable = fv.Lists[KeyFlagDisable]
+	return nil
+}
+
+func (cmd *CommandLint) initDisable() error {
+	for _, name := range cmd.Disable {
+		if purse.SliceContains(lint.GetRuleNames(), name) {
+			continue
+		}
+		msg := purse.Fmt(`
+unknown rule passed to %s: %s
+the rules are %s
+%s`, KeyFlagDisable, name, strings.Join(lint.GetRuleNames(), ", "), errHelp())
+		return fmt.Errorf(msg)
+	}
+	return nil
+}
+
+// initInputs accepts the same directories, files, and globs as
+// gtml build, and lints the working directory without any.
+func (cmd *CommandLint) initInputs() error {
+	args := cmd.FilteredArgs
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	for _, arg := range args {
+		in, err := source.NewInput(arg, nil, nil)
+		if err != nil {
+			return fmt.Errorf("%s\n%s", err.Error(), errHelp())
+		}
+		cmd.Inputs = append(cmd.Inputs, in)
+	}
+	return nil
+}
+
+// ##==================================================================
+type CommandGraph struct {
+	Type         string
+	Args         []string
+	Options      []Option
+	FilteredArgs []string
+	Json         bool
+	Unused       bool
+	Inputs       []*source.Input
+}
+
+func NewCommandGraph(args []string) (*CommandGraph, error) {
+	cmd := &CommandGraph{
+		Type: KeyCommandGraph,
+		Args: args,
+	}
+	err := fungi.Process(
+		func() error { return cmd.initFlags() },
+		func() error { return cmd.initInputs() },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func (cmd *CommandGraph) Print()                    { fmt.Println(cmd.Type) }
+func (cmd *CommandGraph) GetType() string           { return cmd.Type }
+func (cmd *CommandGraph) GetFilteredArgs() []string { return cmd.FilteredArgs }
+func (cmd *CommandGraph) GetOptions() []Option      { return cmd.Options }
+
+func (cmd *CommandGraph) initFlags() error {
+	fv, err := parseCommandFlags(cmd.Type, cmd.Args)
+	if err != nil {
+		return err
+	}
+	cmd.FilteredArgs = fv.Positional
+	cmd.Json = fv.Bools[KeyFlagJson]
+	cmd.Unused = fv.Bools[KeyFlagUnused]
+	if cmd.Json && cmd.Unused {
+		msg := purse.Fmt(`
+%s and %s can not be used together
+%s`, KeyFlagJson, KeyFlagUnused, errHelp())
+		return fmt.Errorf(msg)
+	}
+	return nil
+}
+
+func (cmd *CommandGraph) initInputs() error {
+	args := cmd.FilteredArgs
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	for _, arg := range args {
+		in, err := source.NewInput(arg, nil, nil)
+		if err != nil {
+			return fmt.Errorf("%s\n%s", err.Error(), errHelp())
+		}
+		cmd.Inputs = append(cmd.Inputs, in)
+	}
+	return nil
+}
+
+// ##==================================================================
+type CommandLsp struct {
+	Type         string
+	Args         []string
+	Options      []Option
+	FilteredArgs []string
+}
+
+func NewCommandLsp(args []string) (*CommandLsp, error) {
+	cmd := &CommandLsp{
+		Type: KeyCommandLsp,
+		Args: args,
+	}
+	err := fungi.Process(
+		func() error { return cmd.initFlags() },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func (cmd *CommandLsp) Print()                    { fmt.Println(cmd.Type) }
+func (cmd *CommandLsp) GetType() string           { return cmd.Type }
+func (cmd *CommandLsp) GetFilteredArgs() []string { return cmd.FilteredArgs }
+func (cmd *CommandLsp) GetOptions() []Option      { return cmd.Options }
+
+// initFlags only allows --help, the editor talks to the server over
+// stdin and stdout rather than through arguments.
+func (cmd *CommandLsp) initFlags() error {
+	fv, err := parseCommandFlags(cmd.Type, cmd.Args)
+	if err != nil {
+		return err
+	}
+	cmd.FilteredArgs = fv.Positional
+	if len(cmd.FilteredArgs) > 0 {
+		msg := purse.Fmt(`
+gtml lsp takes no arguments, found: %s
+%s`, strings.Join(cmd.FilteredArgs, " "), errHelp())
+		return fmt.Errorf(msg)
+	}
+	return nil
+}
+
 // ##==================================================================
 type CommandHelp struct {
 	Type         string
 	FilteredArgs []string
 	Options      []Option
+	Topic        string
 }
 
-func NewCommandHelp() (*CommandHelp, error) {
+func NewCommandHelp(args []string) (*CommandHelp, error) {
 	cmd := &CommandHelp{
-		Type: KeyCommandHelp,
+		Type:         KeyCommandHelp,
+		FilteredArgs: args,
+	}
+	err := fungi.Process(
+		func() error { return cmd.initTopic() },
+	)
+	if err != nil {
+		return nil, err
 	}
 	return cmd, nil
 }
@@ -275,6 +818,22 @@ func (cmd *CommandHelp) GetType() string           { return cmd.Type }
 func (cmd *CommandHelp) GetFilteredArgs() []string { return cmd.FilteredArgs }
 func (cmd *CommandHelp) GetOptions() []Option      { return cmd.Options }
 
+// initTopic picks the command to show help for, as in gtml help build.
+func (cmd *CommandHelp) initTopic() error {
+	for _, arg := range cmd.FilteredArgs {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		match := purse.FindMatchInStrSlice(getCommandList(), arg)
+		if match == "" {
+			return fmt.Errorf("unknown command: %s\n%s", arg, errHelp())
+		}
+		cmd.Topic = match
+		return nil
+	}
+	return nil
+}
+
 // ##==================================================================
 
 // ##==================================================================
@@ -1,16 +1,33 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
-	"gtml/src/parser/element"
-	"gtml/src/parser/gtmlfunc"
-	"gtml/src/parser/gtmlvar"
-	"io/fs"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/cache"
+	"github.com/phillip-england/gtml/src/config"
+	"github.com/phillip-england/gtml/src/graph"
+	"github.com/phillip-england/gtml/src/gtmlfmt"
+	"github.com/phillip-england/gtml/src/lint"
+	"github.com/phillip-england/gtml/src/lsp"
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/gtmlfunc"
+	"github.com/phillip-england/gtml/src/parser/param"
+	"github.com/phillip-england/gtml/src/source"
 	"github.com/phillip-england/purse"
 )
 
@@ -41,12 +58,48 @@ type Executor interface {
 
 func NewExecutor(cmd Command) (Executor, error) {
 	if cmd.GetType() == KeyCommandBuild {
+		buildCmd, ok := cmd.(*CommandBuild)
+		if ok && buildCmd.Config != nil {
+			ex, err := NewExecutorTargets(buildCmd)
+			if err != nil {
+				return nil, err
+			}
+			return ex, nil
+		}
 		ex, err := NewExecutorBuild(cmd)
 		if err != nil {
 			return nil, err
 		}
 		return ex, nil
 	}
+	if cmd.GetType() == KeyCommandFmt {
+		ex, err := NewExecutorFmt(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return ex, nil
+	}
+	if cmd.GetType() == KeyCommandLint {
+		ex, err := NewExecutorLint(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return ex, nil
+	}
+	if cmd.GetType() == KeyCommandGraph {
+		ex, err := NewExecutorGraph(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return ex, nil
+	}
+	if cmd.GetType() == KeyCommandLsp {
+		ex, err := NewExecutorLsp(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return ex, nil
+	}
 	if cmd.GetType() == KeyCommandHelp {
 		ex, err := NewExecutorHelp(cmd)
 		if err != nil {
@@ -63,21 +116,50 @@ not executor available for command of type: %s
 // ##==================================================================
 type ExecutorBuild struct {
 	Command          Command
+	Target           *config.Target
+	Options          []Option
+	Input            *source.Input
 	InputDir         string
 	OutputFile       string
 	PackageName      string
+	Escape           string
+	MdTheme          string
 	OutputFileExists bool
+	Cache            *cache.Cache
+	CacheHits        int
+	ComponentCount   int
+	Jobs             int
 }
 
 func NewExecutorBuild(cmd Command) (*ExecutorBuild, error) {
+	args := cmd.GetFilteredArgs()
+	target := &config.Target{
+		Input:   args[0],
+		Output:  args[1],
+		Package: args[2],
+	}
+	target.SetDefaults()
+	return NewExecutorBuildFromTarget(cmd, target)
+}
+
+// NewExecutorBuildFromTarget builds a single target, either from the
+// positional args or from an entry in the config file.
+func NewExecutorBuildFromTarget(cmd Command, target *config.Target) (*ExecutorBuild, error) {
 	ex := &ExecutorBuild{
 		Command: cmd,
+		Target:  target,
 	}
 	err := fungi.Process(
+		func() error { return ex.initTargetFlags() },
+		func() error { return ex.initOptions() },
 		func() error { return ex.initInputDir() },
 		func() error { return ex.initOutputFile() },
 		func() error { return ex.initPackageName() },
+		func() error { return ex.initEscape() },
+		func() error { return ex.initMdTheme() },
 		func() error { return ex.initOutputFileExists() },
+		func() error { return ex.initCache() },
+		func() error { return ex.initJobs() },
 	)
 	if err != nil {
 		return nil, err
@@ -87,29 +169,39 @@ func NewExecutorBuild(cmd Command) (*ExecutorBuild, error) {
 
 func (ex *ExecutorBuild) GetCommand() Command { return ex.Command }
 func (ex *ExecutorBuild) Run() error {
+	fmt.Println(getGtmlArt())
+	return ex.run()
+}
+
+func (ex *ExecutorBuild) run() error {
 
 	process := func() error {
 		err := ex.printIntro()
 		if err != nil {
 			return err
 		}
-		funcs, err := ex.buildComponentFuncs()
+		builds, err := ex.buildComponentFuncs()
 		if err != nil {
 			return err
 		}
-		err = ex.writeComponentFuncs(funcs)
+		if HasOption(ex.Options, KeyOptionOutDir) {
+			err = ex.writeComponentDir(builds)
+		} else {
+			err = ex.writeComponentFuncs(collectFuncs(builds))
+		}
 		if err != nil {
 			return err
 		}
+		if ex.CacheHits > 0 {
+			fmt.Printf("reused %d of %d components from cache\n", ex.CacheHits, ex.ComponentCount)
+		}
 		return nil
 	}
 
-	for _, opt := range ex.Command.GetOptions() {
+	for _, opt := range ex.Options {
 		process = opt.Inject(ex, process)
 	}
 
-	fmt.Println(getGtmlArt())
-
 	err := process()
 	if err != nil {
 		return err
@@ -119,18 +211,78 @@ func (ex *ExecutorBuild) Run() error {
 
 }
 
+// initTargetFlags lets --md-theme and --escape override the settings of
+// the target.
+func (ex *ExecutorBuild) initTargetFlags() error {
+	buildCmd, ok := ex.Command.(*CommandBuild)
+	if !ok {
+		return nil
+	}
+	if buildCmd.MdTheme != "" {
+		ex.Target.MdTheme = buildCmd.MdTheme
+	}
+	if buildCmd.Escape != "" {
+		ex.Target.Escape = buildCmd.Escape
+	}
+	ex.Target.Include = append(ex.Target.Include, buildCmd.Include...)
+	ex.Target.Exclude = append(ex.Target.Exclude, buildCmd.Exclude...)
+	return nil
+}
+
+// initOptions combines the options passed on the command line with the
+// ones switched on by the target in the config file.
+func (ex *ExecutorBuild) initOptions() error {
+	opts := make([]Option, 0)
+	opts = append(opts, ex.Command.GetOptions()...)
+	targetOpts := map[string]bool{
+		KeyOptionOutDir:  ex.Target.OutDir,
+		KeyOptionRuntime: ex.Target.Runtime,
+		KeyOptionMinify:  ex.Target.Minify,
+		KeyOptionWatch:   ex.Target.Watch,
+	}
+	for _, key := range getOptionList() {
+		if !targetOpts[key] || HasOption(opts, key) {
+			continue
+		}
+		opt, err := NewOption(key)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, opt)
+	}
+	ex.Options = opts
+	return nil
+}
+
+// initInputDir resolves the input of the target. For a single file or
+// a glob, InputDir is the directory the files are read from.
 func (ex *ExecutorBuild) initInputDir() error {
-	ex.InputDir = ex.Command.GetFilteredArgs()[0]
+	in, err := source.NewInput(ex.Target.Input, ex.Target.Include, ex.Target.Exclude)
+	if err != nil {
+		return err
+	}
+	ex.Input = in
+	ex.InputDir = in.GetRoot()
 	return nil
 }
 
 func (ex *ExecutorBuild) initOutputFile() error {
-	ex.OutputFile = ex.Command.GetFilteredArgs()[1]
+	ex.OutputFile = ex.Target.Output
 	return nil
 }
 
 func (ex *ExecutorBuild) initPackageName() error {
-	ex.PackageName = ex.Command.GetFilteredArgs()[2]
+	ex.PackageName = ex.Target.Package
+	return nil
+}
+
+func (ex *ExecutorBuild) initEscape() error {
+	ex.Escape = ex.Target.Escape
+	return nil
+}
+
+func (ex *ExecutorBuild) initMdTheme() error {
+	ex.MdTheme = ex.Target.MdTheme
 	return nil
 }
 
@@ -147,6 +299,27 @@ func (ex *ExecutorBuild) initOutputFileExists() error {
 	return nil
 }
 
+func (ex *ExecutorBuild) initCache() error {
+	if HasOption(ex.Options, KeyOptionNoCache) {
+		return nil
+	}
+	path, err := cache.DefaultPath(ex.InputDir, ex.OutputFile)
+	if err != nil {
+		path = "" // no user cache dir, keep the cache in memory
+	}
+	c, err := cache.NewCache(path, cache.Fingerprint(ex.PackageName))
+	if err != nil {
+		return err
+	}
+	ex.Cache = c
+	return nil
+}
+
+func (ex *ExecutorBuild) initJobs() error {
+	ex.Jobs = runtime.GOMAXPROCS(0)
+	return nil
+}
+
 func (ex *ExecutorBuild) printIntro() error {
 	intro := purse.Fmt(`
 building %s 💦`, ex.OutputFile)
@@ -154,257 +327,1122 @@ building %s 💦`, ex.OutputFile)
 	return nil
 }
 
-func (ex *ExecutorBuild) buildComponentFuncs() ([]gtmlfunc.Func, error) {
-	funcs := make([]gtmlfunc.Func, 0)
-	err := filepath.Walk(ex.InputDir, func(path string, info fs.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil // skip all dirs
-		}
-		if !strings.HasSuffix(path, ".html") {
-			return nil // skip all non .html files
+// fileBuild holds the state of a single source file while it moves
+// through the phases of buildComponentFuncs.
+type fileBuild struct {
+	Path  string
+	File  *cache.File
+	Elms  []element.Element
+	Funcs []gtmlfunc.Func
+	Hits  int
+}
+
+// componentJob is a component whose function must be regenerated.
+type componentJob struct {
+	Build    *fileBuild
+	Index    int
+	Siblings []element.Element
+}
+
+func (ex *ExecutorBuild) buildComponentFuncs() ([]*fileBuild, error) {
+	builds := make([]*fileBuild, 0)
+	buildCache := ex.Cache
+	if buildCache == nil {
+		// --no-cache still builds through a cache, it just starts empty every time
+		fresh, err := cache.NewCache("", "")
+		if err != nil {
+			return builds, err
 		}
+		buildCache = fresh
+	}
+	paths, err := ex.Input.GetPaths()
+	if err != nil {
+		return builds, err
+	}
 
-		// extract the html _components from the file
-		compNames, err := element.ReadComponentElementNamesFromFile(path)
+	// parse every file and work out which components are stale
+	builds = make([]*fileBuild, len(paths))
+	err = runJobs(ex.Jobs, len(paths), func(i int) error {
+		fb, err := ex.parseFile(buildCache, paths[i])
 		if err != nil {
 			return err
 		}
-		compSels, err := element.ReadComponentSelectionsFromFile(path)
+		builds[i] = fb
+		return nil
+	})
+	if err != nil {
+		return builds, err
+	}
+
+	// once every file has its name index, components compile independently
+	jobs := make([]componentJob, 0)
+	for _, fb := range builds {
+		jobs = append(jobs, ex.collectComponentJobs(fb)...)
+	}
+	err = runJobs(ex.Jobs, len(jobs), func(i int) error {
+		job := jobs[i]
+		fn, err := gtmlfunc.NewFunc(job.Build.Elms[job.Index], job.Siblings)
 		if err != nil {
 			return err
 		}
-		for _, sel := range compSels {
-			err := element.MarkSelectionPlaceholders(sel, compNames)
+		job.Build.Funcs[job.Index] = fn
+		job.Build.File.Components[job.Index].Data = fn.GetData()
+		return nil
+	})
+	if err != nil {
+		return builds, err
+	}
+
+	// results are assembled in walk order so the output is stable
+	ex.CacheHits = 0
+	ex.ComponentCount = 0
+	for _, fb := range builds {
+		ex.CacheHits += fb.Hits
+		ex.ComponentCount += len(fb.Funcs)
+		buildCache.SetFile(fb.Path, fb.File)
+	}
+	buildCache.Prune(paths)
+	err = buildCache.Save()
+	if err != nil {
+		return builds, err
+	}
+	return builds, nil
+}
+
+func collectFuncs(builds []*fileBuild) []gtmlfunc.Func {
+	funcs := make([]gtmlfunc.Func, 0)
+	for _, fb := range builds {
+		funcs = append(funcs, fb.Funcs...)
+	}
+	return funcs
+}
+
+// parseFile reads the _components found in a single file. Files whose
+// content hash is unchanged are restored from the cache without parsing.
+func (ex *ExecutorBuild) parseFile(buildCache *cache.Cache, path string) (*fileBuild, error) {
+	fb := &fileBuild{
+		Path: path,
+	}
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// minifying changes the markup of every component, so a file built
+	// with --minify is cached apart from one built without
+	fileHash := cache.Hash(string(f))
+	if ex.usesMinify() {
+		fileHash = cache.Hash(string(f), KeyOptionMinify)
+	}
+	oldFile := buildCache.GetFile(path)
+	if oldFile != nil && oldFile.Hash == fileHash {
+		for _, comp := range oldFile.Components {
+			fn, err := gtmlfunc.NewGoCachedFunc(comp.Name, comp.Data, comp.Params)
 			if err != nil {
-				return err
+				return nil, err
 			}
+			fb.Funcs = append(fb.Funcs, fn)
 		}
-		element.MarkSelectionsAsUnique(compSels)
-		compElms, err := element.ConvertSelectionsIntoElements(compSels, compNames)
+		fb.File = oldFile
+		fb.Hits = len(oldFile.Components)
+		return fb, nil
+	}
+
+	// extract the html _components from the file
+	compNames, err := element.ReadComponentElementNamesFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	compSels, err := element.ReadComponentSelectionsFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, sel := range compSels {
+		err := element.MarkSelectionPlaceholders(sel, compNames)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		for _, elm := range compElms {
-			fn, err := gtmlfunc.NewFunc(elm, compElms)
+	}
+	element.MarkSelectionsContext(compSels)
+	err = element.MarkSelectionsScopedSlots(compSels)
+	if err != nil {
+		return nil, err
+	}
+	err = element.MarkSelectionsAssets(compSels)
+	if err != nil {
+		return nil, err
+	}
+	if ex.usesMinify() {
+		element.MinifySelections(compSels)
+	}
+	element.MarkSelectionsAsUnique(compSels)
+	compSels, err = element.AddFragmentSelections(compSels, compNames)
+	if err != nil {
+		return nil, err
+	}
+	compElms, err := element.ConvertSelectionsIntoElements(compSels, compNames)
+	if err != nil {
+		return nil, err
+	}
+
+	// build the dependency graph of the file before generating anything
+	fb.Elms = compElms
+	fb.Funcs = make([]gtmlfunc.Func, len(compElms))
+	fb.File = &cache.File{
+		Hash: fileHash,
+	}
+	for _, elm := range compElms {
+		name := element.GetComponentName(elm)
+		comp := &cache.Component{
+			Name:    name,
+			SrcHash: cache.Hash(elm.GetHtml()),
+			Deps:    element.ReadPlaceholderNames(elm),
+		}
+		old := oldFile.GetComponent(name)
+		if old != nil && old.SrcHash == comp.SrcHash {
+			comp.Params = old.Params
+		} else {
+			params, err := param.NewParamsFromElement(elm)
 			if err != nil {
-				return err
+				return nil, err
+			}
+			for _, p := range params {
+				comp.Params = append(comp.Params, p.GetStr())
 			}
-			funcs = append(funcs, fn)
 		}
-		return nil
-	})
-	if err != nil {
-		return funcs, err
+		fb.File.Components = append(fb.File.Components, comp)
+	}
+
+	// a component is fresh when neither its html nor the params of the
+	// components it uses as placeholders have changed
+	for i, comp := range fb.File.Components {
+		keyParts := []string{comp.SrcHash}
+		for _, dep := range comp.Deps {
+			depComp := fb.File.GetComponent(dep)
+			if depComp == nil {
+				continue
+			}
+			keyParts = append(keyParts, dep, strings.Join(depComp.Params, ","))
+		}
+		comp.Key = cache.Hash(keyParts...)
+		old := oldFile.GetComponent(comp.Name)
+		if old != nil && old.IsFresh(comp.Key) {
+			comp.Data = old.Data
+			fn, err := gtmlfunc.NewGoCachedFunc(comp.Name, comp.Data, comp.Params)
+			if err != nil {
+				return nil, err
+			}
+			fb.Funcs[i] = fn
+			fb.Hits++
+		}
+	}
+	return fb, nil
+}
+
+func (ex *ExecutorBuild) collectComponentJobs(fb *fileBuild) []componentJob {
+	jobs := make([]componentJob, 0)
+	for i, comp := range fb.File.Components {
+		if fb.Funcs[i] != nil {
+			continue
+		}
+		siblings := make([]element.Element, 0)
+		for _, dep := range comp.Deps {
+			for _, elm := range fb.Elms {
+				if element.GetComponentName(elm) == dep {
+					siblings = append(siblings, elm)
+				}
+			}
+		}
+		jobs = append(jobs, componentJob{
+			Build:    fb,
+			Index:    i,
+			Siblings: siblings,
+		})
 	}
-	return funcs, nil
+	return jobs
+}
+
+// runJobs calls fn for every index below count on at most workers
+// goroutines. The error of the lowest failing index is returned so that
+// failures are reported the same way on every run.
+func runJobs(workers int, count int, fn func(i int) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > count {
+		workers = count
+	}
+	errs := make([]error, count)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (ex *ExecutorBuild) writeComponentFuncs(funcs []gtmlfunc.Func) error {
+	output, err := ex.renderComponentFuncs(funcs)
+	if err != nil {
+		return err
+	}
+
+	if HasOption(ex.Options, KeyOptionCheck) {
+		existing, err := os.ReadFile(ex.OutputFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if string(existing) != output {
+			return fmt.Errorf("%s is out of date, run gtml build to regenerate it", ex.OutputFile)
+		}
+		fmt.Printf("%s is up to date\n", ex.OutputFile)
+		return nil
+	}
+
 	// Ensure the directory exists
 	outputDir := filepath.Dir(ex.OutputFile)
-	err := os.MkdirAll(outputDir, 0755) // Create directories if they don't exist
+	err = os.MkdirAll(outputDir, 0755) // Create directories if they don't exist
 	if err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
+	err = os.WriteFile(ex.OutputFile, []byte(output), 0666)
+	if err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
 
-	// Open the file for writing, creating it if it doesn't exist
-	file, err := os.OpenFile(ex.OutputFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+// writeComponentDir writes one file per source file into the output
+// directory, plus gtml_helpers.go. Generated files left over from
+// removed sources are deleted.
+func (ex *ExecutorBuild) writeComponentDir(builds []*fileBuild) error {
+	outputs := make(map[string]string)
+	names := make([]string, 0)
+	sources := make(map[string]string)
+	for _, fb := range builds {
+		if len(fb.Funcs) == 0 {
+			continue
+		}
+		name, err := ex.getSourceFileOutputName(fb.Path)
+		if err != nil {
+			return err
+		}
+		if other, exists := sources[name]; exists {
+			msg := purse.Fmt(`
+%s and %s would both be written to %s
+rename one of the files to use --out-dir`, other, fb.Path, name)
+			return fmt.Errorf(msg)
+		}
+		sources[name] = fb.Path
+		output, err := ex.renderSourceFile(fb.Funcs)
+		if err != nil {
+			return err
+		}
+		outputs[name] = output
+		names = append(names, name)
+	}
+	funcs := collectFuncs(builds)
+	helpers, err := ex.renderHelperFile(getHelperUse(funcs))
 	if err != nil {
-		return fmt.Errorf("failed to create or clear output file: %w", err)
+		return err
 	}
-	defer file.Close()
-	buildIgnore := ""
-	if os.Getenv("GOENV") == "dev" {
-		buildIgnore = "// +build ignore\n"
+	if helpers != "" {
+		outputs[keyHelperFileName] = helpers
+		names = append(names, keyHelperFileName)
+	}
+
+	stale, err := ex.findStaleOutputs(outputs)
+	if err != nil {
+		return err
+	}
+
+	if HasOption(ex.Options, KeyOptionCheck) {
+		outOfDate := make([]string, 0)
+		for _, name := range names {
+			path := filepath.Join(ex.OutputFile, name)
+			existing, err := os.ReadFile(path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if string(existing) != outputs[name] {
+				outOfDate = append(outOfDate, path)
+			}
+		}
+		outOfDate = append(outOfDate, stale...)
+		if len(outOfDate) > 0 {
+			return fmt.Errorf("%s is out of date, run gtml build to regenerate it", strings.Join(outOfDate, ", "))
+		}
+		fmt.Printf("%s is up to date\n", ex.OutputFile)
+		return nil
+	}
+
+	err = os.MkdirAll(ex.OutputFile, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for _, name := range names {
+		path := filepath.Join(ex.OutputFile, name)
+		existing, err := os.ReadFile(path)
+		if err == nil && string(existing) == outputs[name] {
+			continue // leave unchanged files alone so their mtime is kept
+		}
+		err = os.WriteFile(path, []byte(outputs[name]), 0666)
+		if err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+	}
+	for _, path := range stale {
+		err := os.Remove(path)
+		if err != nil {
+			return fmt.Errorf("failed to remove stale output file: %w", err)
+		}
 	}
-	_, err = file.WriteString("// Code generated by gtml; DO NOT EDIT.\n" + buildIgnore + "\n// v0.1.0 | you may see errors with types, you'll need to manage your own imports\n// type support coming soon!" + "\n\n")
+	return nil
+}
+
+const keyHelperFileName = "gtml_helpers.go"
+
+// getSourceFileOutputName maps a source file to its --out-dir file name.
+// Sub directories are flattened into the name so every file stays in
+// the same package: components/forms/input.html -> forms_input_gtml.go
+func (ex *ExecutorBuild) getSourceFileOutputName(path string) (string, error) {
+	rel, err := filepath.Rel(ex.InputDir, path)
 	if err != nil {
-		return fmt.Errorf("failed to write ignore declaration: %w", err)
+		return "", err
+	}
+	rel = strings.TrimSuffix(filepath.ToSlash(rel), ".html")
+	name := strings.ReplaceAll(rel, "/", "_")
+	// the go tool ignores files starting with '_' or '.'
+	name = strings.TrimLeft(name, "_.")
+	if name == "" {
+		name = "component"
+	}
+	return name + "_gtml.go", nil
+}
+
+// findStaleOutputs returns generated files in the output directory that
+// are no longer part of outputs. Only files carrying the gtml header
+// are considered, hand written files are never touched.
+func (ex *ExecutorBuild) findStaleOutputs(outputs map[string]string) ([]string, error) {
+	stale := make([]string, 0)
+	entries, err := os.ReadDir(ex.OutputFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stale, nil
+		}
+		return stale, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if !strings.HasSuffix(name, "_gtml.go") && name != keyHelperFileName {
+			continue
+		}
+		if _, exists := outputs[name]; exists {
+			continue
+		}
+		path := filepath.Join(ex.OutputFile, name)
+		f, err := os.ReadFile(path)
+		if err != nil {
+			return stale, err
+		}
+		if strings.HasPrefix(string(f), keyGeneratedHeader) {
+			stale = append(stale, path)
+		}
 	}
+	return stale, nil
+}
 
-	// Write package declaration
-	_, err = file.WriteString("package " + ex.PackageName + "\n\n")
+// renderComponentFuncs produces the full output file. Components are
+// sorted by name and the file is passed through go/format, so the same
+// sources always produce byte for byte the same output.
+func (ex *ExecutorBuild) renderComponentFuncs(funcs []gtmlfunc.Func) (string, error) {
+	data, runtimeImports, err := ex.getSortedFuncData(funcs)
 	if err != nil {
-		return fmt.Errorf("failed to write package declaration: %w", err)
+		return "", err
+	}
+	inline := !ex.usesRuntime()
+	use := getHelperUse(funcs)
+
+	var builder strings.Builder
+	builder.WriteString(ex.getOutputHeader())
+
+	helpers := ""
+	imports := []string{`"strings"`}
+	if inline {
+		helpers, imports, err = getHelpers(use)
+		if err != nil {
+			return "", err
+		}
 	}
 
 	// Write import block
-	imports := []string{"\"strings\""}
-	foundMd := false
+	if use.Ctx && !inline {
+		// the helpers are gone but the signatures still take a context
+		imports = append(imports, `"context"`)
+	}
+	imports = append(imports, runtimeImports...)
+	builder.WriteString(getImportBlock(imports) + "\n\n")
+
+	// Write helper functions
+	builder.WriteString(helpers + "\n")
+	builder.WriteString(getBundleFuncs(use))
+
+	// Write function data
+	builder.WriteString(data)
+
+	return formatOutput(builder.String())
+}
+
+// renderSourceFile produces the --out-dir file for a single source
+// file. The helpers it calls live in gtml_helpers.go or the runtime.
+func (ex *ExecutorBuild) renderSourceFile(funcs []gtmlfunc.Func) (string, error) {
+	data, runtimeImports, err := ex.getSortedFuncData(funcs)
+	if err != nil {
+		return "", err
+	}
+	imports := []string{`"strings"`}
+	if usesCtx(funcs) {
+		imports = append(imports, `"context"`)
+	}
+	imports = append(imports, runtimeImports...)
+	var builder strings.Builder
+	builder.WriteString(ex.getOutputHeader())
+	builder.WriteString(getImportBlock(imports) + "\n\n")
+	builder.WriteString(data)
+	return formatOutput(builder.String())
+}
+
+// renderHelperFile produces gtml_helpers.go for --out-dir builds. With
+// --runtime only the bundles are left to write, so the file may be empty.
+func (ex *ExecutorBuild) renderHelperFile(use helperUse) (string, error) {
+	inline := !ex.usesRuntime()
+	bundles := getBundleFuncs(use)
+	if !inline && bundles == "" {
+		return "", nil
+	}
+	var builder strings.Builder
+	builder.WriteString(ex.getOutputHeader())
+	if inline {
+		helpers, imports, err := getHelpers(use)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(getImportBlock(imports) + "\n\n")
+		builder.WriteString(helpers + "\n")
+	}
+	builder.WriteString(bundles)
+	return formatOutput(builder.String())
+}
+
+func (ex *ExecutorBuild) getOutputHeader() string {
+	buildIgnore := ""
+	if os.Getenv("GOENV") == "dev" {
+		buildIgnore = "// +build ignore\n"
+	}
+	header := keyGeneratedHeader + "\n" + buildIgnore + "\n// v0.1.0 | you may see errors with types, you'll need to manage your own imports\n// type support coming soon!" + "\n\n"
+	return header + "package " + ex.PackageName + "\n\n"
+}
+
+const keyGeneratedHeader = "// Code generated by gtml; DO NOT EDIT."
+
+func (ex *ExecutorBuild) usesRuntime() bool {
+	return HasOption(ex.Options, KeyOptionRuntime)
+}
+
+func (ex *ExecutorBuild) usesMinify() bool {
+	return HasOption(ex.Options, KeyOptionMinify)
+}
+
+// helperUse records which of the helpers only written when needed the
+// generated funcs call.
+// Styles and Scripts name the components with _scoped styles and _once
+// scripts, which GtmlStyles and GtmlScripts are written for.
+type helperUse struct {
+	Md       bool
+	Ctx      bool
+	Rest     bool
+	Document bool
+	Styles   []string
+	Scripts  []string
+}
+
+func getHelperUse(funcs []gtmlfunc.Func) helperUse {
+	use := helperUse{
+		Md:       usesMd(funcs),
+		Ctx:      usesCtx(funcs),
+		Rest:     usesRest(funcs),
+		Document: usesDocument(funcs),
+		Styles:   make([]string, 0),
+		Scripts:  make([]string, 0),
+	}
 	for _, fn := range funcs {
-		vars := fn.GetVars()
-		for _, v := range vars {
-			if v.GetType() == gtmlvar.KeyVarGoPlaceholder {
-				elm := v.GetElement()
-				err := element.WalkElementChildren(elm, func(child element.Element) error {
-					if child.GetType() == element.KeyElementMd {
-						foundMd = true
-					}
-					return nil
-				})
-				if err != nil {
-					return err
-				}
+		if strings.Contains(fn.GetData(), "const "+gtmlfunc.GetStyleConstName(fn.GetName())+" ") {
+			use.Styles = append(use.Styles, fn.GetName())
+		}
+		if strings.Contains(fn.GetData(), "const "+gtmlfunc.GetScriptConstName(fn.GetName())+" ") {
+			use.Scripts = append(use.Scripts, fn.GetName())
+		}
+	}
+	sort.Strings(use.Styles)
+	sort.Strings(use.Scripts)
+	return use
+}
+
+// getBundleFuncs returns GtmlStyles and GtmlScripts, which join the
+// _scoped styles and _once scripts of every component in order of their
+// name. Each is only written when a component has something for it.
+func getBundleFuncs(use helperUse) string {
+	bundles := ""
+	if len(use.Styles) > 0 {
+		consts := make([]string, 0, len(use.Styles))
+		for _, name := range use.Styles {
+			consts = append(consts, gtmlfunc.GetStyleConstName(name))
+		}
+		bundles += purse.RemoveFirstLine(`
+// GtmlStyles returns the _scoped styles of every component.
+func GtmlStyles() string {
+	return ` + strings.Join(consts, " + ") + `
+}
+`)
+	}
+	if len(use.Scripts) > 0 {
+		consts := make([]string, 0, len(use.Scripts))
+		for _, name := range use.Scripts {
+			consts = append(consts, gtmlfunc.GetScriptConstName(name))
+		}
+		bundles += purse.RemoveFirstLine(`
+// GtmlScripts returns the _once scripts of every component.
+func GtmlScripts() string {
+	return ` + strings.Join(consts, " + ") + `
+}
+`)
+	}
+	return bundles
+}
+
+func usesMd(funcs []gtmlfunc.Func) bool {
+	for _, fn := range funcs {
+		if strings.Contains(fn.GetData(), "gtmlMd(") {
+			return true
+		}
+	}
+	return false
+}
+
+// usesDocument reports whether any of funcs renders a whole page, which
+// brings in the gtmlDocument helper.
+func usesDocument(funcs []gtmlfunc.Func) bool {
+	for _, fn := range funcs {
+		if strings.Contains(fn.GetData(), "gtmlDocument(") {
+			return true
+		}
+	}
+	return false
+}
+
+// usesCtx reports whether any of funcs takes a context.Context, which
+// brings in the context import and the gtmlCtx helper.
+func usesCtx(funcs []gtmlfunc.Func) bool {
+	for _, fn := range funcs {
+		for _, p := range fn.GetParams() {
+			if p.GetType() == param.KeyParamCtxType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usesRest reports whether any of funcs spreads the attributes it is
+// passed with _rest, which brings in the sort import and the gtmlRest
+// helper.
+func usesRest(funcs []gtmlfunc.Func) bool {
+	for _, fn := range funcs {
+		for _, p := range fn.GetParams() {
+			if p.GetName() == param.KeyParamAttrs && p.GetType() == param.KeyParamAttrsType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getSortedFuncData joins the data of funcs in order of their name. With
+// --runtime the helper calls are pointed at the runtime packages, which
+// are returned as the imports the data needs.
+func (ex *ExecutorBuild) getSortedFuncData(funcs []gtmlfunc.Func) (string, []string, error) {
+	sorted := make([]gtmlfunc.Func, len(funcs))
+	copy(sorted, funcs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetName() < sorted[j].GetName()
+	})
+	runtime := ex.usesRuntime()
+	escape := ex.Escape != config.KeyEscapeNone
+	imports := make([]string, 0)
+	var builder strings.Builder
+	for _, fn := range sorted {
+		data := fn.GetData()
+		if runtime || !escape || strings.Contains(data, "gtmlMd(") {
+			rewritten, found, err := rewriteHelperCalls(data, runtime, escape, ex.MdTheme)
+			if err != nil {
+				return "", nil, err
 			}
-			if v.GetType() == gtmlvar.KeyVarGoMd {
-				foundMd = true
+			data = rewritten
+			for _, imp := range found {
+				if !purse.SliceContains(imports, imp) {
+					imports = append(imports, imp)
+				}
 			}
 		}
+		builder.WriteString(data + "\n\n")
 	}
-	if foundMd {
-		imports = append(imports, "\t"+`chromahtml "github.com/alecthomas/chroma/v2/formatters/html"`)
-		imports = append(imports, "\t"+`highlighting "github.com/yuin/goldmark-highlighting/v2"`)
-		imports = append(imports, "\t"+`goldmarkhtml "github.com/yuin/goldmark/renderer/html"`)
-		imports = append(imports, "\t"+`"github.com/yuin/goldmark"`)
-		imports = append(imports, "\t"+`"github.com/yuin/goldmark/parser"`)
-		imports = append(imports, "\t"+`"bytes"`)
-		imports = append(imports, "\t"+`"os"`)
-		imports = append(imports, "\t"+`"github.com/PuerkitoBio/goquery"`)
-		imports = append(imports, "\t"+`"fmt"`)
+	sort.Strings(imports)
+	return builder.String(), imports, nil
+}
+
+func formatOutput(src string) (string, error) {
+	code, err := format.Source([]byte(src))
+	if err != nil {
+		return "", fmt.Errorf("failed to format output file: %w", err)
 	}
-	var importBlock string
-	if len(imports) == 1 {
-		importBlock = "import \"strings\""
-	} else {
-		importStr := strings.Join(imports, "\n")
-		importBlock = purse.Fmt(`
-import (
-	%s
+	return string(code), nil
+}
+
+const (
+	keyRuntimeImport   = `gtml "github.com/phillip-england/gtml/runtime"`
+	keyRuntimeMdImport = `gtmlmd "github.com/phillip-england/gtml/runtime/md"`
 )
-		`, importStr)
-	}
-	_, err = file.WriteString(importBlock + "\n\n")
-	if err != nil {
-		return fmt.Errorf("failed to write import block: %w", err)
-	}
-
-	// setting up gtmlMd
-	var gtmlMd string
-	if foundMd {
-		gtmlMd = purse.RemoveFirstLine(`
-func gtmlMd(mdPath string, theme string) string {
-    if len(mdPath) == 0 {
-        fmt.Println("_md elements require a valid path")
-    }
-    firstChar := string(mdPath[0])
-    if firstChar != "." {
-        mdPath = "."+mdPath
-    }
- 	mdFileContent, _ := os.ReadFile(mdPath)
-	md := goldmark.New(
-		goldmark.WithExtensions(
-			highlighting.NewHighlighting(
-				highlighting.WithStyle(theme),
-				highlighting.WithFormatOptions(
-					chromahtml.WithLineNumbers(true),
-				),
-			),
-		),
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
-		),
-		goldmark.WithRendererOptions(
-			goldmarkhtml.WithHardWraps(),
-			goldmarkhtml.WithXHTML(),
-			goldmarkhtml.WithUnsafe(),
-		),
-	)
-	var buf bytes.Buffer
-	_ = md.Convert([]byte(mdFileContent), &buf)
-	str := buf.String()
-	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(str))
-
-	doc.Find("*").Each(func(i int, inner *goquery.Selection) {
-		nodeName := goquery.NodeName(inner)
-		currentStyle, _ := inner.Attr("style")
-		switch nodeName {
-		case "pre":
-			inner.SetAttr("style", currentStyle+"padding: 1rem; font-size: 0.875rem; overflow-x: auto; border-radius: 0.25rem; margin-bottom: 1rem;")
-		case "h1":
-			inner.SetAttr("style", currentStyle+"font-weight: bold; font-size: 1.875rem; padding-bottom: 1rem;")
-		case "h2":
-			inner.SetAttr("style", currentStyle+"font-size: 1.5rem; font-weight: bold; padding-bottom: 1rem; padding-top: 0.5rem; border-top-width: 1px; border-top-style: solid; border-color: #1f2937; padding-top: 1rem;")
-		case "h3":
-			inner.SetAttr("style", currentStyle+"font-size: 1.25rem; font-weight: bold; margin-top: 1.5rem; margin-bottom: 1rem;")
-		case "p":
-			inner.SetAttr("style", currentStyle+"font-size: 0.875rem; line-height: 1.5; margin-bottom: 1rem;")
-		case "ul":
-			inner.SetAttr("style", currentStyle+"padding-left: 1.5rem; margin-bottom: 1rem; list-style-type: disc;")
-		case "ol":
-			inner.SetAttr("style", currentStyle+"padding-left: 1.5rem; margin-bottom: 1rem; list-style-type: decimal;")
-		case "li":
-			inner.SetAttr("style", currentStyle+"margin-bottom: 0.5rem;")
-		case "blockquote":
-			inner.SetAttr("style", currentStyle+"margin-left: 1rem; padding-left: 1rem; border-left: 4px solid #ccc; font-style: italic; color: #555;")
-		case "code":
-			parent := inner.Parent()
-			if goquery.NodeName(parent) == "pre" {
-				return
+
+// runtimeHelpers maps the inlined helper names onto the runtime package.
+// gtmlMd is missing, it comes from runtime/md so the runtime does not pull
+// goldmark, chroma and goquery into every package which imports it.
+var runtimeHelpers = map[string]string{
+	"gtmlFor":      "For",
+	"gtmlIf":       "If",
+	"gtmlElse":     "Else",
+	"gtmlSlot":     "Slot",
+	"gtmlEscape":   "Escape",
+	"gtmlCtx":      "Ctx",
+	"gtmlAttr":     "Attr",
+	"gtmlClass":    "Class",
+	"gtmlRest":     "Rest",
+	"gtmlDocument": "Document",
+}
+
+// rewriteHelperCalls turns calls like gtmlFor(...) in a generated func
+// into gtml.For(...) when runtime is set, and unwraps gtmlEscape(...)
+// when escape is not. gtmlMd(...) becomes gtmlmd.Render(...), given
+// mdTheme when the _md element names no theme of its own. The imports of
+// the runtime packages it calls are returned.
+func rewriteHelperCalls(data string, runtime bool, escape bool, mdTheme string) (string, []string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", "package p\n\n"+data, parser.ParseComments)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse generated func: %w", err)
+	}
+	found := make([]string, 0)
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if !escape {
+			for i, arg := range call.Args {
+				inner, ok := arg.(*ast.CallExpr)
+				if !ok || len(inner.Args) != 1 {
+					continue
+				}
+				ident, ok := inner.Fun.(*ast.Ident)
+				if ok && ident.Name == "gtmlEscape" {
+					call.Args[i] = inner.Args[0]
+				}
 			}
-			inner.SetAttr("style", currentStyle+"font-family: monospace; background-color: #1f2937; padding: 0.25rem 0.5rem; border-radius: 0.25rem;")
-		case "hr":
-			inner.SetAttr("style", currentStyle+"border: none; border-top: 1px solid #ccc; margin: 2rem 0;")
-		case "a":
-			inner.SetAttr("style", currentStyle+"color: #007BFF; text-decoration: none;")
-		case "img":
-			inner.SetAttr("style", currentStyle+"max-width: 100%; height: auto; border-radius: 0.25rem; margin: 1rem 0;")
 		}
+		ident, ok := call.Fun.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if ident.Name == "gtmlMd" && len(call.Args) == 2 {
+			if theme, ok := call.Args[1].(*ast.BasicLit); ok && theme.Value == `""` {
+				theme.Value = strconv.Quote(mdTheme)
+			}
+			if !runtime {
+				return true
+			}
+			call.Fun = &ast.SelectorExpr{
+				X:   ast.NewIdent("gtmlmd"),
+				Sel: ast.NewIdent("Render"),
+			}
+			if !purse.SliceContains(found, keyRuntimeMdImport) {
+				found = append(found, keyRuntimeMdImport)
+			}
+			return true
+		}
+		if !runtime {
+			return true
+		}
+		name, ok := runtimeHelpers[ident.Name]
+		if !ok {
+			return true
+		}
+		call.Fun = &ast.SelectorExpr{
+			X:   ast.NewIdent("gtml"),
+			Sel: ast.NewIdent(name),
+		}
+		if !purse.SliceContains(found, keyRuntimeImport) {
+			found = append(found, keyRuntimeImport)
+		}
+		return true
 	})
-	modifiedHTML, _ := doc.Html()
-	return modifiedHTML
+	var builder strings.Builder
+	for _, decl := range file.Decls {
+		err := printer.Fprint(&builder, fset, decl)
+		if err != nil {
+			return "", nil, err
+		}
+		builder.WriteString("\n")
+	}
+	return strings.TrimSuffix(builder.String(), "\n"), found, nil
 }
-`)
+
+func getImportBlock(imports []string) string {
+	if len(imports) == 1 {
+		return "import " + imports[0]
 	}
+	return "import (\n\t" + strings.Join(imports, "\n\t") + "\n)"
+}
 
-	// Write helper functions
-	_, err = file.WriteString(purse.Fmt(`
-func gtmlFor[T any](slice []T, callback func(i int, item T) string) string {
-	var builder strings.Builder
-	for i, item := range slice {
-		builder.WriteString(callback(i, item))
+// ##==================================================================
+type ExecutorTargets struct {
+	Command Command
+	Config  *config.Config
+	Builds  []*ExecutorBuild
+}
+
+// NewExecutorTargets builds every target listed in the config file.
+func NewExecutorTargets(cmd *CommandBuild) (*ExecutorTargets, error) {
+	ex := &ExecutorTargets{
+		Command: cmd,
+		Config:  cmd.Config,
 	}
-	return builder.String()
+	err := fungi.Process(
+		func() error { return ex.initBuilds() },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return ex, nil
 }
 
-func gtmlIf(condition bool, fn func() string) string {
-if condition {
-	return fn()
+func (ex *ExecutorTargets) GetCommand() Command { return ex.Command }
+
+// Run builds the targets in order. Targets with watch enabled keep
+// running once every target has been built.
+func (ex *ExecutorTargets) Run() error {
+	fmt.Println(getGtmlArt())
+	watching := make([]*ExecutorBuild, 0)
+	for _, build := range ex.Builds {
+		if HasOption(build.Options, KeyOptionWatch) {
+			watching = append(watching, build)
+			continue
+		}
+		err := build.run()
+		if err != nil {
+			return fmt.Errorf("target %s: %w", build.Target.Name, err)
+		}
+	}
+	if len(watching) == 0 {
+		return nil
+	}
+	errs := make(chan error)
+	for _, build := range watching {
+		go func(build *ExecutorBuild) {
+			err := build.run()
+			if err != nil {
+				errs <- fmt.Errorf("target %s: %w", build.Target.Name, err)
+			}
+		}(build)
+	}
+	return <-errs
 }
-	return ""
+
+func (ex *ExecutorTargets) initBuilds() error {
+	for _, target := range ex.Config.Targets {
+		build, err := NewExecutorBuildFromTarget(ex.Command, target)
+		if err != nil {
+			return fmt.Errorf("target %s: %w", target.Name, err)
+		}
+		ex.Builds = append(ex.Builds, build)
+	}
+	return nil
 }
 
-func gtmlElse(condition bool, fn func() string) string {
-	if !condition {
-		return fn()
+// ##==================================================================
+type ExecutorFmt struct {
+	Command *CommandFmt
+	Stdin   io.Reader
+	Stdout  io.Writer
+}
+
+func NewExecutorFmt(cmd Command) (*ExecutorFmt, error) {
+	fmtCmd, ok := cmd.(*CommandFmt)
+	if !ok {
+		return nil, fmt.Errorf("gtml fmt executor given a command of type: %s", cmd.GetType())
 	}
-	return ""
+	ex := &ExecutorFmt{
+		Command: fmtCmd,
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+	}
+	return ex, nil
 }
 
-func gtmlSlot(contentFunc func() string) string {
-	return contentFunc()
+func (ex *ExecutorFmt) GetCommand() Command { return ex.Command }
+
+// Run formats every input file like gofmt: the result goes to stdout
+// unless -l, -w or -d say otherwise. A file which fails to format is
+// reported and skipped so the rest still get formatted.
+func (ex *ExecutorFmt) Run() error {
+	if len(ex.Command.Inputs) == 0 {
+		src, err := io.ReadAll(ex.Stdin)
+		if err != nil {
+			return err
+		}
+		return ex.formatSource("<standard input>", src, 0)
+	}
+	failed := 0
+	for _, in := range ex.Command.Inputs {
+		paths, err := in.GetPaths()
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			src, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			err = ex.formatSource(path, src, info.Mode().Perm())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err.Error())
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("gtml fmt: %d file(s) could not be formatted", failed)
+	}
+	return nil
+}
+
+func (ex *ExecutorFmt) formatSource(path string, src []byte, perm os.FileMode) error {
+	out, err := gtmlfmt.Format(src)
+	if err != nil {
+		return err
+	}
+	changed := string(out) != string(src)
+	cmd := ex.Command
+	if cmd.List && changed {
+		fmt.Fprintln(ex.Stdout, path)
+	}
+	if cmd.Write && changed {
+		err := os.WriteFile(path, out, perm)
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Diff && changed {
+		fmt.Fprint(ex.Stdout, gtmlfmt.Diff(path, src, out))
+	}
+	if !cmd.List && !cmd.Write && !cmd.Diff {
+		_, err := ex.Stdout.Write(out)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func gtmlEscape(input string) string {
-	return input
+// ##==================================================================
+type ExecutorLint struct {
+	Command *CommandLint
+	Rules   []lint.Rule
+	Stdout  io.Writer
 }
 
-%s
-`, gtmlMd))
+func NewExecutorLint(cmd Command) (*ExecutorLint, error) {
+	lintCmd, ok := cmd.(*CommandLint)
+	if !ok {
+		return nil, fmt.Errorf("gtml lint executor given a command of type: %s", cmd.GetType())
+	}
+	ex := &ExecutorLint{
+		Command: lintCmd,
+		Stdout:  os.Stdout,
+	}
+	for _, rule := range lint.GetRules() {
+		if purse.SliceContains(lintCmd.Disable, rule.GetName()) {
+			continue
+		}
+		ex.Rules = append(ex.Rules, rule)
+	}
+	return ex, nil
+}
+
+func (ex *ExecutorLint) GetCommand() Command { return ex.Command }
+
+// Run prints every problem found, one per line or as JSON, and fails
+// when there is at least one so CI can gate on it.
+func (ex *ExecutorLint) Run() error {
+	paths, err := getInputPaths(ex.Command.Inputs)
 	if err != nil {
-		return fmt.Errorf("failed to write helper functions: %w", err)
+		return err
+	}
+	diagnostics, err := lint.Lint(paths, ex.Rules)
+	if err != nil {
+		return err
+	}
+	if ex.Command.Json {
+		out, err := json.MarshalIndent(diagnostics, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(ex.Stdout, string(out))
+	} else {
+		for _, d := range diagnostics {
+			fmt.Fprintln(ex.Stdout, d.String())
+		}
+	}
+	if len(diagnostics) > 0 {
+		return fmt.Errorf("gtml lint: %d problem(s) found", len(diagnostics))
 	}
+	return nil
+}
 
-	// Write function data
-	for _, fn := range funcs {
-		_, err = file.WriteString(fn.GetData() + "\n\n")
+// getInputPaths returns the files of every input once, in walk order.
+func getInputPaths(inputs []*source.Input) ([]string, error) {
+	paths := make([]string, 0)
+	for _, in := range inputs {
+		inPaths, err := in.GetPaths()
 		if err != nil {
-			return fmt.Errorf("failed to write function data: %w", err)
+			return paths, err
+		}
+		for _, path := range inPaths {
+			if !purse.SliceContains(paths, path) {
+				paths = append(paths, path)
+			}
 		}
 	}
+	return paths, nil
+}
+
+// ##==================================================================
+type ExecutorGraph struct {
+	Command *CommandGraph
+	Stdout  io.Writer
+}
+
+func NewExecutorGraph(cmd Command) (*ExecutorGraph, error) {
+	graphCmd, ok := cmd.(*CommandGraph)
+	if !ok {
+		return nil, fmt.Errorf("gtml graph executor given a command of type: %s", cmd.GetType())
+	}
+	ex := &ExecutorGraph{
+		Command: graphCmd,
+		Stdout:  os.Stdout,
+	}
+	return ex, nil
+}
 
+func (ex *ExecutorGraph) GetCommand() Command { return ex.Command }
+
+// Run prints the graph, then fails if it has a cycle, since a component
+// which ends up using itself recurses forever when rendered.
+func (ex *ExecutorGraph) Run() error {
+	paths, err := getInputPaths(ex.Command.Inputs)
+	if err != nil {
+		return err
+	}
+	moduleDir, err := graph.FindModuleDir(".")
+	if err != nil {
+		return err
+	}
+	g, err := graph.NewGraph(paths, moduleDir)
+	if err != nil {
+		return err
+	}
+	switch {
+	case ex.Command.Json:
+		out, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(ex.Stdout, string(out))
+	case ex.Command.Unused:
+		for _, name := range g.Unused {
+			fmt.Fprintln(ex.Stdout, name)
+		}
+	default:
+		fmt.Fprint(ex.Stdout, g.Dot())
+	}
+	if len(g.Cycles) > 0 {
+		cycles := make([]string, 0)
+		for _, cycle := range g.Cycles {
+			cycles = append(cycles, "  "+strings.Join(cycle, " -> "))
+		}
+		return fmt.Errorf("gtml graph: found %d placeholder cycle(s), these components would render forever:\n%s", len(g.Cycles), strings.Join(cycles, "\n"))
+	}
 	return nil
 }
 
+// ##==================================================================
+type ExecutorLsp struct {
+	Command *CommandLsp
+	Stdin   io.Reader
+	Stdout  io.Writer
+}
+
+func NewExecutorLsp(cmd Command) (*ExecutorLsp, error) {
+	lspCmd, ok := cmd.(*CommandLsp)
+	if !ok {
+		return nil, fmt.Errorf("gtml lsp executor given a command of type: %s", cmd.GetType())
+	}
+	ex := &ExecutorLsp{
+		Command: lspCmd,
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+	}
+	return ex, nil
+}
+
+func (ex *ExecutorLsp) GetCommand() Command { return ex.Command }
+
+// Run serves until the editor exits. Nothing else may be written to
+// stdout, the editor reads every byte of it as protocol.
+func (ex *ExecutorLsp) Run() error {
+	return lsp.NewServer(ex.Stdin, ex.Stdout).Run()
+}
+
 // ##==================================================================
 type ExecutorHelp struct {
 	Command Command
@@ -419,19 +1457,13 @@ func NewExecutorHelp(cmd Command) (*ExecutorHelp, error) {
 
 func (ex *ExecutorHelp) GetCommand() Command { return ex.Command }
 func (ex *ExecutorHelp) Run() error {
-	message := fmt.Sprintf(`
-%s
-Usage:
-  gtml [OPTIONS]... [INPUT DIR] [OUTPUT FILE] [GO PACKAGE NAME]
-
-Example:
-  gtml --watch build ./components output.go output
-
-Options:
-  --watch       rebuild when source files are modified
-`, getGtmlArt())
-	message = purse.RemoveFirstLine(message)
-	fmt.Println(message)
+	topic := ""
+	helpCmd, ok := ex.Command.(*CommandHelp)
+	if ok {
+		topic = helpCmd.Topic
+	}
+	fmt.Println(getGtmlArt())
+	fmt.Print(getHelpText(topic))
 	return nil
 }
 
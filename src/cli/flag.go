@@ -0,0 +1,292 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/phillip-england/gtml/src/lint"
+)
+
+// ##==================================================================
+const (
+	KeyFlagMdTheme = "--md-theme"
+	KeyFlagEscape  = "--escape"
+	KeyFlagInclude = "--include"
+	KeyFlagExclude = "--exclude"
+	KeyFlagList    = "-l"
+	KeyFlagWrite   = "-w"
+	KeyFlagDiff    = "-d"
+	KeyFlagJson    = "--json"
+	KeyFlagDisable = "--disable"
+	KeyFlagUnused  = "--unused"
+)
+
+// ##==================================================================
+
+// Flag describes a flag accepted by a command. The same list registers
+// the flag with the parser and generates the help text, so the two can
+// not drift apart.
+type Flag struct {
+	Name  string
+	Value string // shown in help for flags which take a value, empty for bools
+	Usage string
+	Multi bool // the flag may be given more than once
+}
+
+func (f Flag) GetName() string { return strings.TrimLeft(f.Name, "-") }
+func (f Flag) IsBool() bool    { return f.Value == "" }
+
+func getCommandFlags(cmdType string) []Flag {
+	if cmdType == KeyCommandBuild {
+		return []Flag{
+			{Name: KeyOptionWatch, Usage: "rebuild when component or _md files change"},
+			{Name: KeyOptionNoCache, Usage: "ignore the build cache and regenerate every component"},
+			{Name: KeyOptionCheck, Usage: "fail instead of writing if the output file is out of date"},
+			{Name: KeyOptionOutDir, Usage: "treat OUTPUT FILE as a directory and write one file per source file"},
+			{Name: KeyOptionRuntime, Usage: "import helpers from gtml/runtime instead of writing them into the output"},
+			{Name: KeyOptionMinify, Usage: "collapse whitespace and drop comments in the generated markup"},
+			{Name: KeyFlagMdTheme, Value: "THEME", Usage: "theme for _md elements without an _md-theme (default dracula)"},
+			{Name: KeyFlagEscape, Value: "MODE", Usage: "escaping of $prop and $val values, html or none (default html)"},
+			{Name: KeyFlagInclude, Value: "PATTERN", Usage: "only read files matching PATTERN, may be repeated", Multi: true},
+			{Name: KeyFlagExclude, Value: "PATTERN", Usage: "skip files and directories matching PATTERN, may be repeated", Multi: true},
+		}
+	}
+	if cmdType == KeyCommandFmt {
+		return []Flag{
+			{Name: KeyFlagList, Usage: "list files whose formatting differs from gtml fmt's"},
+			{Name: KeyFlagWrite, Usage: "write the result to the source file instead of stdout"},
+			{Name: KeyFlagDiff, Usage: "print diffs instead of rewriting files"},
+		}
+	}
+	if cmdType == KeyCommandLint {
+		return []Flag{
+			{Name: KeyFlagJson, Usage: "print problems as a JSON array"},
+			{Name: KeyFlagDisable, Value: "RULE", Usage: "turn off RULE, may be repeated", Multi: true},
+		}
+	}
+	if cmdType == KeyCommandGraph {
+		return []Flag{
+			{Name: KeyFlagJson, Usage: "print the graph as JSON instead of DOT"},
+			{Name: KeyFlagUnused, Usage: "only print the components nothing uses, one per line"},
+		}
+	}
+	return []Flag{}
+}
+
+func getCommandUsage(cmdType string) []string {
+	if cmdType == KeyCommandBuild {
+		return []string{
+			"gtml build [OPTIONS]... [INPUT DIR] [OUTPUT FILE] [PACKAGE NAME]",
+			"gtml build [OPTIONS]... [INPUT DIR]    (writes <dir>_gtml.go and infers the package)",
+			"gtml build [OPTIONS]... './ui/**/*.html' [OUTPUT FILE] [PACKAGE NAME]",
+			"gtml build [OPTIONS]...    (reads targets from gtml.toml or gtml.yaml)",
+		}
+	}
+	if cmdType == KeyCommandFmt {
+		return []string{
+			"gtml fmt [-l] [-w] [-d] [PATH]...    (formats stdin when no PATH is given)",
+		}
+	}
+	if cmdType == KeyCommandLint {
+		return []string{
+			"gtml lint [OPTIONS]... [PATH]...    (lints the current directory when no PATH is given)",
+		}
+	}
+	if cmdType == KeyCommandGraph {
+		return []string{
+			"gtml graph [OPTIONS]... [PATH]...    (reads the current directory when no PATH is given)",
+		}
+	}
+	if cmdType == KeyCommandLsp {
+		return []string{
+			"gtml lsp    (speaks the Language Server Protocol over stdin and stdout)",
+		}
+	}
+	if cmdType == KeyCommandHelp {
+		return []string{"gtml help [COMMAND]"}
+	}
+	return []string{}
+}
+
+func getCommandSummary(cmdType string) string {
+	if cmdType == KeyCommandBuild {
+		return "generate go functions from html components"
+	}
+	if cmdType == KeyCommandFmt {
+		return "rewrite component files in the canonical format"
+	}
+	if cmdType == KeyCommandLint {
+		return "report template mistakes the compiler lets through"
+	}
+	if cmdType == KeyCommandGraph {
+		return "show which components use which, and find cycles and unused components"
+	}
+	if cmdType == KeyCommandLsp {
+		return "run a language server for editors"
+	}
+	if cmdType == KeyCommandHelp {
+		return "show usage for gtml or a single command"
+	}
+	return ""
+}
+
+func getCommandExample(cmdType string) string {
+	if cmdType == KeyCommandBuild {
+		return "gtml build --watch ./components ./output.go output"
+	}
+	if cmdType == KeyCommandFmt {
+		return "gtml fmt -w ./components"
+	}
+	if cmdType == KeyCommandLint {
+		return "gtml lint --json --disable unused-prop ./components"
+	}
+	if cmdType == KeyCommandGraph {
+		return "gtml graph ./components | dot -Tsvg > components.svg"
+	}
+	if cmdType == KeyCommandLsp {
+		return "gtml lsp"
+	}
+	return ""
+}
+
+// ##==================================================================
+
+// FlagValues holds the result of parsing the args of a command.
+type FlagValues struct {
+	Positional []string
+	Bools      map[string]bool
+	Values     map[string]string
+	Lists      map[string][]string
+}
+
+// listValue collects every use of a Multi flag.
+type listValue []string
+
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+func (v *listValue) Set(s string) error {
+	*v = append(*v, s)
+	return nil
+}
+
+// parseCommandFlags parses args against the flags of cmdType. Flags may
+// appear before, after, or between positional args, in the forms
+// --flag, --flag=value, and --flag value. Everything after "--" is
+// positional.
+func parseCommandFlags(cmdType string, args []string) (*FlagValues, error) {
+	fs := flag.NewFlagSet("gtml "+cmdType, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	bools := make(map[string]*bool)
+	values := make(map[string]*string)
+	lists := make(map[string]*listValue)
+	for _, f := range getCommandFlags(cmdType) {
+		if f.IsBool() {
+			bools[f.Name] = fs.Bool(f.GetName(), false, f.Usage)
+			continue
+		}
+		if f.Multi {
+			lists[f.Name] = &listValue{}
+			fs.Var(lists[f.Name], f.GetName(), f.Usage)
+			continue
+		}
+		values[f.Name] = fs.String(f.GetName(), "", f.Usage)
+	}
+
+	trailing := make([]string, 0)
+	for i, arg := range args {
+		if arg == "--" {
+			trailing = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+
+	fv := &FlagValues{
+		Positional: make([]string, 0),
+		Bools:      make(map[string]bool),
+		Values:     make(map[string]string),
+		Lists:      make(map[string][]string),
+	}
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			if err == flag.ErrHelp {
+				return nil, err
+			}
+			msg := strings.Replace(err.Error(), " -", " --", 1)
+			return nil, fmt.Errorf("%s\nRun 'gtml help %s' for usage.", msg, cmdType)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		fv.Positional = append(fv.Positional, args[0])
+		args = args[1:]
+	}
+	fv.Positional = append(fv.Positional, trailing...)
+
+	for name, val := range bools {
+		fv.Bools[name] = *val
+	}
+	for name, val := range values {
+		fv.Values[name] = *val
+	}
+	for name, val := range lists {
+		fv.Lists[name] = []string(*val)
+	}
+	return fv, nil
+}
+
+// getHelpText generates the usage text for a single command, or for
+// every command when cmdType is empty.
+func getHelpText(cmdType string) string {
+	var builder strings.Builder
+	cmdTypes := getCommandList()
+	if cmdType != "" {
+		cmdTypes = []string{cmdType}
+	}
+
+	builder.WriteString("Usage:\n")
+	for _, t := range cmdTypes {
+		for _, usage := range getCommandUsage(t) {
+			builder.WriteString("  " + usage + "\n")
+		}
+	}
+
+	if cmdType == "" {
+		builder.WriteString("\nCommands:\n")
+		for _, t := range cmdTypes {
+			builder.WriteString(fmt.Sprintf("  %-10s %s\n", t, getCommandSummary(t)))
+		}
+	}
+
+	for _, t := range cmdTypes {
+		flags := getCommandFlags(t)
+		if len(flags) == 0 {
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("\nOptions for %s:\n", t))
+		for _, f := range flags {
+			name := f.Name
+			if !f.IsBool() {
+				name += " " + f.Value
+			}
+			builder.WriteString(fmt.Sprintf("  %-20s %s\n", name, f.Usage))
+		}
+	}
+
+	if cmdType == KeyCommandLint {
+		builder.WriteString("\nRules for lint:\n")
+		for _, rule := range lint.GetRules() {
+			builder.WriteString(fmt.Sprintf("  %-20s %s\n", rule.GetName(), rule.GetSummary()))
+		}
+	}
+
+	example := getCommandExample(KeyCommandBuild)
+	if cmdType != "" && getCommandExample(cmdType) != "" {
+		example = getCommandExample(cmdType)
+	}
+	builder.WriteString("\nExample:\n  " + example + "\n")
+	return builder.String()
+}
@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/phillip-england/gtml/runtime"
+	"github.com/phillip-england/gtml/runtime/md"
+	"github.com/phillip-england/purse"
+)
+
+// getHelpers returns the helpers written into a generated file which does
+// not import the runtime packages, along with the imports they need. They
+// are taken from the source of the runtime packages, so the inlined
+// helpers and the runtime never drift apart. gtmlCtx, GtmlWithCtx,
+// gtmlRest, gtmlDocument and gtmlMd are only written when a component
+// calls them.
+func getHelpers(use helperUse) (string, []string, error) {
+	names := []string{"For", "If", "Else", "Slot", "Escape", "Attr", "Class"}
+	if use.Ctx {
+		names = append(names, "Ctx", "WithCtx")
+	}
+	if use.Rest {
+		names = append(names, "Rest")
+	}
+	if use.Document {
+		names = append(names, "Document")
+	}
+	inlineNames := make(map[string]string)
+	for inlineName, name := range runtimeHelpers {
+		inlineNames[name] = inlineName
+	}
+	// the handlers setting $ctx values often live in another package, so
+	// the setter stays exported
+	inlineNames["WithCtx"] = "GtmlWithCtx"
+	helpers, imports, err := extractHelpers(runtime.Source, names, inlineNames)
+	if err != nil {
+		return "", nil, err
+	}
+	if use.Md {
+		mdHelpers, mdImports, err := extractHelpers(md.Source, []string{"Render"}, map[string]string{"Render": "gtmlMd"})
+		if err != nil {
+			return "", nil, err
+		}
+		helpers += "\n" + mdHelpers
+		imports = append(imports, mdImports...)
+	}
+	all := []string{`"strings"`}
+	for _, imp := range imports {
+		if !purse.SliceContains(all, imp) {
+			all = append(all, imp)
+		}
+	}
+	return helpers, all, nil
+}
+
+// extractHelpers returns the decls of src named in names, along with
+// every decl of src they rely on, and the imports they need. Each decl is
+// renamed so it does not clash with the package it is written into, by
+// inlineNames or else with a gtml prefix, as getBuffer becomes
+// gtmlGetBuffer. The decls are written in the order of src.
+func extractHelpers(src string, names []string, inlineNames map[string]string) (string, []string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse the runtime source: %w", err)
+	}
+	decls := make(map[string]ast.Decl)
+	for _, decl := range file.Decls {
+		for _, name := range getDeclNames(decl) {
+			decls[name] = decl
+		}
+	}
+	imports := make(map[string]string)
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return "", nil, err
+		}
+		name := path.Base(importPath)
+		text := spec.Path.Value
+		if spec.Name != nil {
+			name = spec.Name.Name
+			text = spec.Name.Name + " " + spec.Path.Value
+		}
+		imports[name] = text
+	}
+
+	// the decls needed are found from the names, through every identifier
+	// of theirs which names another decl
+	needed := make(map[ast.Decl]bool)
+	usedImports := make([]string, 0)
+	queue := make([]string, 0)
+	queue = append(queue, names...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		decl, ok := decls[name]
+		if !ok {
+			return "", nil, fmt.Errorf("the runtime source has no decl named %s", name)
+		}
+		if needed[decl] {
+			continue
+		}
+		needed[decl] = true
+		ast.Inspect(decl, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.SelectorExpr:
+				if x, ok := n.X.(*ast.Ident); ok {
+					if imp, ok := imports[x.Name]; ok && !purse.SliceContains(usedImports, imp) {
+						usedImports = append(usedImports, imp)
+					}
+				}
+				ast.Inspect(n.X, func(inner ast.Node) bool {
+					if ident, ok := inner.(*ast.Ident); ok && decls[ident.Name] != nil {
+						queue = append(queue, ident.Name)
+					}
+					return true
+				})
+				return false
+			case *ast.Ident:
+				if decls[n.Name] != nil {
+					queue = append(queue, n.Name)
+				}
+			}
+			return true
+		})
+	}
+
+	var builder strings.Builder
+	for _, decl := range file.Decls {
+		if !needed[decl] {
+			continue
+		}
+		renameDecl(decl, decls, inlineNames)
+		// the doc comments speak of the runtime names, so only the
+		// comments within a decl are kept
+		comments := make([]*ast.CommentGroup, 0)
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			d.Doc = nil
+		case *ast.GenDecl:
+			d.Doc = nil
+		}
+		for _, group := range file.Comments {
+			if group.Pos() > decl.Pos() && group.End() < decl.End() {
+				comments = append(comments, group)
+			}
+		}
+		err := printer.Fprint(&builder, fset, &printer.CommentedNode{Node: decl, Comments: comments})
+		if err != nil {
+			return "", nil, err
+		}
+		builder.WriteString("\n\n")
+	}
+	sort.Strings(usedImports)
+	return builder.String(), usedImports, nil
+}
+
+// getDeclNames returns the names a top level decl declares.
+func getDeclNames(decl ast.Decl) []string {
+	names := make([]string, 0)
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv == nil {
+			names = append(names, d.Name.Name)
+		}
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.ValueSpec:
+				for _, name := range s.Names {
+					names = append(names, name.Name)
+				}
+			case *ast.TypeSpec:
+				names = append(names, s.Name.Name)
+			}
+		}
+	}
+	return names
+}
+
+// renameDecl renames every identifier in decl which names one of decls.
+// The fields and methods picked with a selector are left alone.
+func renameDecl(decl ast.Decl, decls map[string]ast.Decl, inlineNames map[string]string) {
+	var rename func(node ast.Node) bool
+	rename = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, rename)
+			return false
+		case *ast.Ident:
+			if decls[n.Name] != nil {
+				n.Name = getInlineName(n.Name, inlineNames)
+			}
+		}
+		return true
+	}
+	ast.Inspect(decl, rename)
+}
+
+func getInlineName(name string, inlineNames map[string]string) string {
+	if inlineName, ok := inlineNames[name]; ok {
+		return inlineName
+	}
+	first, size := utf8.DecodeRuneInString(name)
+	return "gtml" + string(unicode.ToUpper(first)) + name[size:]
+}
@@ -2,20 +2,41 @@ package cli
 
 import (
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/source"
 	"github.com/phillip-england/purse"
 )
 
 // ##==================================================================
 const (
-	KeyOptionWatch = "--watch"
+	KeyOptionWatch   = "--watch"
+	KeyOptionNoCache = "--no-cache"
+	KeyOptionCheck   = "--check"
+	KeyOptionOutDir  = "--out-dir"
+	KeyOptionRuntime = "--runtime"
+	KeyOptionMinify  = "--minify"
 )
 
 // ##==================================================================
 func getOptionList() []string {
-	return []string{KeyOptionWatch}
+	return []string{KeyOptionWatch, KeyOptionNoCache, KeyOptionCheck, KeyOptionOutDir, KeyOptionRuntime, KeyOptionMinify}
+}
+
+func HasOption(opts []Option, optType string) bool {
+	for _, opt := range opts {
+		if opt.GetType() == optType {
+			return true
+		}
+	}
+	return false
 }
 
 // ##==================================================================
@@ -37,10 +58,145 @@ func NewOption(arg string) (Option, error) {
 			return nil, err
 		}
 		return opt, err
+	case KeyOptionNoCache:
+		opt, err := NewOptionNoCache()
+		if err != nil {
+			return nil, err
+		}
+		return opt, err
+	case KeyOptionCheck:
+		opt, err := NewOptionCheck()
+		if err != nil {
+			return nil, err
+		}
+		return opt, err
+	case KeyOptionOutDir:
+		opt, err := NewOptionOutDir()
+		if err != nil {
+			return nil, err
+		}
+		return opt, err
+	case KeyOptionRuntime:
+		opt, err := NewOptionRuntime()
+		if err != nil {
+			return nil, err
+		}
+		return opt, err
+	case KeyOptionMinify:
+		opt, err := NewOptionMinify()
+		if err != nil {
+			return nil, err
+		}
+		return opt, err
 	}
 	return nil, fmt.Errorf("invalid option selected: %s\nRun 'gtml help' for usage.", arg)
 }
 
+// ##==================================================================
+type OptionNoCache struct {
+	Type string
+}
+
+func NewOptionNoCache() (*OptionNoCache, error) {
+	opt := &OptionNoCache{
+		Type: KeyOptionNoCache,
+	}
+	return opt, nil
+}
+
+func (opt *OptionNoCache) GetType() string { return opt.Type }
+func (opt *OptionNoCache) Print()          { fmt.Println(opt.Type) }
+
+// Inject leaves the process untouched, ExecutorBuild reads the option
+// when it sets up its cache.
+func (opt *OptionNoCache) Inject(ex Executor, process func() error) func() error {
+	return process
+}
+
+// ##==================================================================
+type OptionCheck struct {
+	Type string
+}
+
+func NewOptionCheck() (*OptionCheck, error) {
+	opt := &OptionCheck{
+		Type: KeyOptionCheck,
+	}
+	return opt, nil
+}
+
+func (opt *OptionCheck) GetType() string { return opt.Type }
+func (opt *OptionCheck) Print()          { fmt.Println(opt.Type) }
+
+// Inject leaves the process untouched, ExecutorBuild compares instead
+// of writing when the option is present.
+func (opt *OptionCheck) Inject(ex Executor, process func() error) func() error {
+	return process
+}
+
+// ##==================================================================
+type OptionOutDir struct {
+	Type string
+}
+
+func NewOptionOutDir() (*OptionOutDir, error) {
+	opt := &OptionOutDir{
+		Type: KeyOptionOutDir,
+	}
+	return opt, nil
+}
+
+func (opt *OptionOutDir) GetType() string { return opt.Type }
+func (opt *OptionOutDir) Print()          { fmt.Println(opt.Type) }
+
+// Inject leaves the process untouched, CommandBuild and ExecutorBuild
+// treat the output path as a directory when the option is present.
+func (opt *OptionOutDir) Inject(ex Executor, process func() error) func() error {
+	return process
+}
+
+// ##==================================================================
+type OptionRuntime struct {
+	Type string
+}
+
+func NewOptionRuntime() (*OptionRuntime, error) {
+	opt := &OptionRuntime{
+		Type: KeyOptionRuntime,
+	}
+	return opt, nil
+}
+
+func (opt *OptionRuntime) GetType() string { return opt.Type }
+func (opt *OptionRuntime) Print()          { fmt.Println(opt.Type) }
+
+// Inject leaves the process untouched, ExecutorBuild imports gtml/runtime
+// instead of writing the helpers when the option is present.
+func (opt *OptionRuntime) Inject(ex Executor, process func() error) func() error {
+	return process
+}
+
+// ##==================================================================
+type OptionMinify struct {
+	Type string
+}
+
+func NewOptionMinify() (*OptionMinify, error) {
+	opt := &OptionMinify{
+		Type: KeyOptionMinify,
+	}
+	return opt, nil
+}
+
+func (opt *OptionMinify) GetType() string { return opt.Type }
+func (opt *OptionMinify) Print()          { fmt.Println(opt.Type) }
+
+// Inject leaves the process untouched, ExecutorBuild minifies the markup
+// of each component as it is parsed when the option is present.
+func (opt *OptionMinify) Inject(ex Executor, process func() error) func() error {
+	return process
+}
+
 // ##==================================================================
 type OptionWatch struct {
 	Type string
@@ -63,8 +219,20 @@ func (opt *OptionWatch) Inject(ex Executor, process func() error) func() error {
 		}
 		defer watcher.Close()
 
-		dirToWatch := ex.GetCommand().GetFilteredArgs()[0]
-		if err := watcher.Add(dirToWatch); err != nil {
+		build, ok := ex.(*ExecutorBuild)
+		if !ok {
+			return fmt.Errorf("%s can only be used with gtml build", KeyOptionWatch)
+		}
+		dirToWatch := filepath.Clean(build.InputDir)
+		state := &watchState{
+			Watcher:  watcher,
+			Input:    build.Input,
+			InputDir: dirToWatch,
+			Dirs:     make(map[string]bool),
+			MdDirs:   make(map[string]bool),
+			MdFiles:  make(map[string]bool),
+		}
+		if err := state.addDirTree(dirToWatch); err != nil {
 			return err
 		}
 
@@ -72,6 +240,9 @@ func (opt *OptionWatch) Inject(ex Executor, process func() error) func() error {
 		if err != nil {
 			return err
 		}
+		if err := state.refreshMdFiles(); err != nil {
+			return err
+		}
 
 		var debounceTimer *time.Timer
 		debounceDuration := 100 * time.Millisecond
@@ -84,19 +255,28 @@ func (opt *OptionWatch) Inject(ex Executor, process func() error) func() error {
 						return
 					}
 
-					if event.Op&fsnotify.Write == fsnotify.Write {
-						fmt.Printf("File modified: %s\n", event.Name)
+					if !state.handleEvent(event) {
+						continue
+					}
+					fmt.Printf("%s: %s\n", describeWatchOp(event.Op), event.Name)
 
-						if debounceTimer != nil {
-							debounceTimer.Stop()
-						}
-						debounceTimer = time.AfterFunc(debounceDuration, func() {
-							err := process()
-							if err != nil {
-								fmt.Printf("Error running process: %v\n", err)
-							}
-						})
+					if debounceTimer != nil {
+						debounceTimer.Stop()
 					}
+					debounceTimer = time.AfterFunc(debounceDuration, func() {
+						// the timer of an earlier event may have fired already,
+						// so its rebuild is waited for rather than run alongside
+						state.buildMu.Lock()
+						defer state.buildMu.Unlock()
+						err := process()
+						if err != nil {
+							fmt.Printf("Error running process: %v\n", err)
+						}
+						err = state.refreshMdFiles()
+						if err != nil {
+							fmt.Printf("Error watching markdown files: %v\n", err)
+						}
+					})
 
 				case err, ok := <-watcher.Errors:
 					if !ok {
@@ -111,3 +291,138 @@ func (opt *OptionWatch) Inject(ex Executor, process func() error) func() error {
 		select {} // Block forever.
 	}
 }
+
+// watchState tracks everything --watch has registered with fsnotify.
+// fsnotify is not recursive, so every directory below the input dir is
+// added on its own, and markdown files referenced by _md elements are
+// watched through their parent directory so rename-on-save editors work.
+type watchState struct {
+	mu       sync.Mutex
+	buildMu  sync.Mutex // held while a rebuild runs
+	Watcher  *fsnotify.Watcher
+	Input    *source.Input
+	InputDir string
+	Dirs     map[string]bool
+	MdDirs   map[string]bool
+	MdFiles  map[string]bool
+}
+
+func (state *watchState) addDirTree(root string) error {
+	return filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		path = filepath.Clean(path)
+		if path != state.InputDir && state.Input.IsExcluded(path) {
+			return filepath.SkipDir
+		}
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		if state.Dirs[path] {
+			return nil
+		}
+		if err := state.Watcher.Add(path); err != nil {
+			return err
+		}
+		state.Dirs[path] = true
+		return nil
+	})
+}
+
+func (state *watchState) refreshMdFiles() error {
+	mdFiles := make(map[string]bool)
+	paths, err := state.Input.GetPaths()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		mdPaths, err := element.ReadMdPathsFromFile(path)
+		if err != nil {
+			return err
+		}
+		for _, mdPath := range mdPaths {
+			mdFiles[filepath.Clean(mdPath)] = true
+		}
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.MdFiles = mdFiles
+	for mdPath := range mdFiles {
+		mdDir := filepath.Dir(mdPath)
+		if state.Dirs[mdDir] || state.MdDirs[mdDir] {
+			continue
+		}
+		if _, err := os.Stat(mdDir); err != nil {
+			continue // the build reports missing markdown files
+		}
+		if err := state.Watcher.Add(mdDir); err != nil {
+			return err
+		}
+		state.MdDirs[mdDir] = true
+	}
+	return nil
+}
+
+// handleEvent updates the watch list and reports whether the event
+// should trigger a rebuild.
+func (state *watchState) handleEvent(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	path := filepath.Clean(event.Name)
+	state.mu.Lock()
+	isMd := state.MdFiles[path]
+	wasDir := state.Dirs[path]
+	if wasDir && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		for dir := range state.Dirs {
+			if dir == path || strings.HasPrefix(dir, path+string(filepath.Separator)) {
+				delete(state.Dirs, dir)
+			}
+		}
+	}
+	state.mu.Unlock()
+	if isMd {
+		return true
+	}
+	if !state.isInInputDir(path) {
+		return false
+	}
+	if wasDir {
+		return true
+	}
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		info, err := os.Stat(path)
+		if err == nil && info.IsDir() {
+			if state.Input.IsExcluded(path) {
+				return false
+			}
+			if err := state.addDirTree(path); err != nil {
+				fmt.Printf("Watcher error: %v\n", err)
+			}
+			return true
+		}
+	}
+	return state.Input.Matches(path)
+}
+
+func (state *watchState) isInInputDir(path string) bool {
+	if state.InputDir == "." {
+		return !filepath.IsAbs(path) && !strings.HasPrefix(path, "..")
+	}
+	return path == state.InputDir || strings.HasPrefix(path, state.InputDir+string(filepath.Separator))
+}
+
+func describeWatchOp(op fsnotify.Op) string {
+	switch {
+	case op&fsnotify.Create == fsnotify.Create:
+		return "File created"
+	case op&fsnotify.Remove == fsnotify.Remove:
+		return "File removed"
+	case op&fsnotify.Rename == fsnotify.Rename:
+		return "File renamed"
+	}
+	return "File modified"
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/phillip-england/purse"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	KeyEscapeHtml = "html"
+	KeyEscapeNone = "none"
+)
+
+const KeyDefaultMdTheme = "dracula"
+
+// getConfigFileNames lists the files gtml build looks for, in order,
+// when it is run without arguments.
+func getConfigFileNames() []string {
+	return []string{"gtml.toml", "gtml.yaml", "gtml.yml"}
+}
+
+// Config is a project file listing every target gtml build should
+// generate in one invocation.
+type Config struct {
+	Path    string    `toml:"-" yaml:"-"`
+	Targets []*Target `toml:"targets" yaml:"targets"`
+}
+
+// Target is a single component directory and where its output goes.
+type Target struct {
+	Name    string   `toml:"name" yaml:"name"`
+	Input   string   `toml:"input" yaml:"input"`
+	Output  string   `toml:"output" yaml:"output"`
+	Package string   `toml:"package" yaml:"package"`
+	OutDir  bool     `toml:"out_dir" yaml:"out_dir"`
+	Runtime bool     `toml:"runtime" yaml:"runtime"`
+	Minify  bool     `toml:"minify" yaml:"minify"`
+	Escape  string   `toml:"escape" yaml:"escape"`
+	MdTheme string   `toml:"md_theme" yaml:"md_theme"`
+	Watch   bool     `toml:"watch" yaml:"watch"`
+	Include []string `toml:"include" yaml:"include"`
+	Exclude []string `toml:"exclude" yaml:"exclude"`
+}
+
+// FindConfigFile returns the first config file found in dir, or "" if
+// there is none.
+func FindConfigFile(dir string) (string, error) {
+	for _, name := range getConfigFileNames() {
+		path := filepath.Join(dir, name)
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func NewConfig(path string) (*Config, error) {
+	c := &Config{
+		Path: path,
+	}
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".toml") {
+		meta, err := toml.Decode(string(f), c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		undecoded := meta.Undecoded()
+		if len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown key in %s: %s", path, undecoded[0].String())
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(f))
+		dec.KnownFields(true)
+		err := dec.Decode(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+	if len(c.Targets) == 0 {
+		msg := purse.Fmt(`
+%s does not list any targets
+add at least one target with an input`, path)
+		return nil, fmt.Errorf(msg)
+	}
+	for i, target := range c.Targets {
+		target.SetDefaults()
+		if target.Name == "" {
+			target.Name = fmt.Sprintf("%d", i+1)
+		}
+		err := target.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("%s: target %s: %w", path, target.Name, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *Config) Print() { fmt.Println(c.Path) }
+
+// SetDefaults fills in the settings a target may leave out.
+func (t *Target) SetDefaults() {
+	if t.Escape == "" {
+		t.Escape = KeyEscapeHtml
+	}
+	if t.MdTheme == "" {
+		t.MdTheme = KeyDefaultMdTheme
+	}
+}
+
+func (t *Target) Validate() error {
+	if t.Input == "" {
+		return fmt.Errorf("missing input")
+	}
+	if t.Escape != KeyEscapeHtml && t.Escape != KeyEscapeNone {
+		return fmt.Errorf("invalid escape mode %q, use %q or %q", t.Escape, KeyEscapeHtml, KeyEscapeNone)
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package graph
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/lint"
+	"github.com/phillip-england/purse"
+)
+
+// Graph is every component and the components it uses as placeholders,
+// labelled with the slots it fills.
+type Graph struct {
+	Components []*Component `json:"components"`
+	Edges      []*Edge      `json:"edges"`
+	Cycles     [][]string   `json:"cycles"`
+	Unused     []string     `json:"unused"`
+	ModuleDir  string       `json:"-"`
+
+	cycleGroups map[string]string // the first component of each cycle group, by its members
+}
+
+type Component struct {
+	Name  string   `json:"name"`
+	Path  string   `json:"path"`
+	Slots []string `json:"slots"` // the slots it renders with $slot
+}
+
+type Edge struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Slots []string `json:"slots"` // the slots From fills
+}
+
+// NewGraph reads the components in paths. Go files under moduleDir are
+// scanned for calls to the components, pass an empty moduleDir to skip
+// the scan.
+func NewGraph(paths []string, moduleDir string) (*Graph, error) {
+	g := &Graph{
+		Components: make([]*Component, 0),
+		Edges:      make([]*Edge, 0),
+		Cycles:     make([][]string, 0),
+		Unused:     make([]string, 0),
+		ModuleDir:  moduleDir,
+
+		cycleGroups: make(map[string]string),
+	}
+	err := fungi.Process(
+		func() error { return g.initComponents(paths) },
+		func() error { return g.initCycles() },
+		func() error { return g.initUnused() },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *Graph) initComponents(paths []string) error {
+	for _, path := range paths {
+		file, err := lint.NewFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err.Error())
+		}
+		for _, comp := range file.Components {
+			// a name defined twice is one node, gtml build rejects the
+			// duplicate when both end up in the same output
+			if g.GetComponent(comp.Name) == nil {
+				g.Components = append(g.Components, &Component{
+					Name:  comp.Name,
+					Path:  path,
+					Slots: append(make([]string, 0), comp.Slots...),
+				})
+			}
+			for _, use := range lint.GetPlaceholderUses(file, comp) {
+				edge := g.GetEdge(comp.Name, use.Target.Name)
+				if edge == nil {
+					edge = &Edge{
+						From:  comp.Name,
+						To:    use.Target.Name,
+						Slots: make([]string, 0),
+					}
+					g.Edges = append(g.Edges, edge)
+				}
+				for _, slot := range use.Slots {
+					if !purse.SliceContains(edge.Slots, slot) {
+						edge.Slots = append(edge.Slots, slot)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (g *Graph) GetComponent(name string) *Component {
+	for _, comp := range g.Components {
+		if comp.Name == name {
+			return comp
+		}
+	}
+	return nil
+}
+
+func (g *Graph) GetEdge(from string, to string) *Edge {
+	for _, edge := range g.Edges {
+		if edge.From == from && edge.To == to {
+			return edge
+		}
+	}
+	return nil
+}
+
+// GetUses returns the names of the components name uses, in the order
+// they were found.
+func (g *Graph) GetUses(name string) []string {
+	uses := make([]string, 0)
+	for _, edge := range g.Edges {
+		if edge.From == name {
+			uses = append(uses, edge.To)
+		}
+	}
+	return uses
+}
+
+// initCycles finds the groups of components which use one another, the
+// strongly connected components of the graph, with Tarjan's algorithm.
+// Each group is reported once, as its shortest cycle from its
+// alphabetically first component back to itself, as in A -> B -> A.
+func (g *Graph) initCycles() error {
+	index := make(map[string]int)
+	lowLink := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	var connect func(name string)
+	connect = func(name string) {
+		index[name] = len(index)
+		lowLink[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, use := range g.GetUses(name) {
+			if _, ok := index[use]; !ok {
+				connect(use)
+				lowLink[name] = min(lowLink[name], lowLink[use])
+			} else if onStack[use] {
+				lowLink[name] = min(lowLink[name], index[use])
+			}
+		}
+		if lowLink[name] != index[name] {
+			return
+		}
+		group := make([]string, 0)
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			group = append(group, top)
+			if top == name {
+				break
+			}
+		}
+		// a component on its own is only a cycle when it uses itself
+		if len(group) == 1 && g.GetEdge(name, name) == nil {
+			return
+		}
+		for _, member := range group {
+			g.cycleGroups[member] = group[0]
+		}
+		g.Cycles = append(g.Cycles, g.getShortestCycle(group))
+	}
+	for _, comp := range g.Components {
+		if _, ok := index[comp.Name]; !ok {
+			connect(comp.Name)
+		}
+	}
+	sort.Slice(g.Cycles, func(i, j int) bool {
+		return strings.Join(g.Cycles[i], " ") < strings.Join(g.Cycles[j], " ")
+	})
+	return nil
+}
+
+// getShortestCycle returns the shortest cycle through the alphabetically
+// first component of group, found with a breadth first search over the
+// edges within group. It starts and ends with that component.
+func (g *Graph) getShortestCycle(group []string) []string {
+	start := slices.Min(group)
+	parents := make(map[string]string)
+	queue := []string{start}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, use := range g.GetUses(name) {
+			if use == start {
+				cycle := []string{start}
+				for at := name; at != start; at = parents[at] {
+					cycle = append(cycle, at)
+				}
+				slices.Reverse(cycle[1:])
+				return append(cycle, start)
+			}
+			if _, seen := parents[use]; seen || !slices.Contains(group, use) {
+				continue
+			}
+			parents[use] = name
+			queue = append(queue, use)
+		}
+	}
+	return []string{start, start}
+}
+
+// initUnused lists the components which are neither used as a
+// placeholder nor called from the Go code of the module.
+func (g *Graph) initUnused() error {
+	called, err := g.getGoCalls()
+	if err != nil {
+		return err
+	}
+	for _, comp := range g.Components {
+		used := called[comp.Name]
+		for _, edge := range g.Edges {
+			if edge.To == comp.Name && edge.From != comp.Name {
+				used = true
+			}
+		}
+		if !used {
+			g.Unused = append(g.Unused, comp.Name)
+		}
+	}
+	return nil
+}
+
+// getGoCalls returns the name of every function called from the Go
+// files of the module. Generated files, including the output of gtml
+// build, are skipped since they call every component.
+func (g *Graph) getGoCalls() (map[string]bool, error) {
+	called := make(map[string]bool)
+	if g.ModuleDir == "" {
+		return called, nil
+	}
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(g.ModuleDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != g.ModuleDir && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			// a broken Go file should not hide the rest of the module
+			return nil
+		}
+		if ast.IsGenerated(f) {
+			return nil
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			switch fn := call.Fun.(type) {
+			case *ast.Ident:
+				called[fn.Name] = true
+			case *ast.SelectorExpr:
+				called[fn.Sel.Name] = true
+			}
+			return true
+		})
+		return nil
+	})
+	return called, err
+}
+
+// FindModuleDir returns the closest directory at or above dir holding a
+// go.mod, or an empty string when there is none.
+func FindModuleDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		_, err := os.Stat(filepath.Join(abs, "go.mod"))
+		if err == nil {
+			return abs, nil
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return "", nil
+		}
+		abs = parent
+	}
+}
+
+// ##==================================================================
+
+// IsCycleEdge reports whether the edge from -> to is part of a cycle,
+// that is whether both ends are in the same cycle group.
+func (g *Graph) IsCycleEdge(from string, to string) bool {
+	fromGroup, ok := g.cycleGroups[from]
+	return ok && g.cycleGroups[to] == fromGroup
+}
+
+// Dot renders the graph in the DOT language. Edges are labelled with the
+// slots they fill, cycles are drawn in red, and unused components are
+// dashed.
+func (g *Graph) Dot() string {
+	var builder strings.Builder
+	builder.WriteString("digraph gtml {\n")
+	builder.WriteString("    node [shape=box];\n")
+	for _, comp := range g.Components {
+		attrs := []string{fmt.Sprintf("tooltip=%q", comp.Path)}
+		if purse.SliceContains(g.Unused, comp.Name) {
+			attrs = append(attrs, "style=dashed")
+		}
+		builder.WriteString(fmt.Sprintf("    %q [%s];\n", comp.Name, strings.Join(attrs, ", ")))
+	}
+	for _, edge := range g.Edges {
+		attrs := make([]string, 0)
+		if len(edge.Slots) > 0 {
+			attrs = append(attrs, fmt.Sprintf("label=%q", strings.Join(edge.Slots, ", ")))
+		}
+		if g.IsCycleEdge(edge.From, edge.To) {
+			attrs = append(attrs, "color=red")
+		}
+		line := fmt.Sprintf("    %q -> %q", edge.From, edge.To)
+		if len(attrs) > 0 {
+			line += " [" + strings.Join(attrs, ", ") + "]"
+		}
+		builder.WriteString(line + ";\n")
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
@@ -0,0 +1,108 @@
+package gtmlfmt
+
+import (
+	"fmt"
+	"strings"
+)
+
+const KeyDiffContext = 3
+
+// Diff returns a unified diff turning a into b, or an empty string when
+// they are equal. Component files are small, so a plain longest common
+// subsequence over lines is fast enough.
+func Diff(name string, a []byte, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+	aLines := splitLines(string(a))
+	bLines := splitLines(string(b))
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// aLines[i:] and bLines[j:]
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type edit struct {
+		op   byte
+		line string
+		a, b int
+	}
+	edits := make([]edit, 0)
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			edits = append(edits, edit{' ', aLines[i], i, j})
+			i++
+			j++
+		case i < len(aLines) && (j == len(bLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', aLines[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', bLines[j], i, j})
+			j++
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("--- %s.orig\n+++ %s\n", name, name))
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+		// grow the hunk until there are more than two context
+		// windows of unchanged lines before the next change
+		first := max(start-KeyDiffContext, 0)
+		end := start
+		for k := start; k < len(edits); k++ {
+			if edits[k].op != ' ' {
+				end = k
+				continue
+			}
+			if k-end > KeyDiffContext*2 {
+				break
+			}
+		}
+		last := min(end+KeyDiffContext, len(edits)-1)
+		aCount, bCount := 0, 0
+		for _, e := range edits[first : last+1] {
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+		}
+		builder.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", edits[first].a+1, aCount, edits[first].b+1, bCount))
+		for _, e := range edits[first : last+1] {
+			builder.WriteString(string(e.op) + e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				builder.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = last + 1
+	}
+	return builder.String()
+}
+
+// splitLines splits s into lines which keep their line break, so a last
+// line without one differs from the same line with one.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
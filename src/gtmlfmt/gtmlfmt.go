@@ -0,0 +1,447 @@
+package gtmlfmt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/phillip-england/gtml/src/parser/element"
+	"golang.org/x/net/html"
+)
+
+const KeyIndent = "    "
+
+const (
+	KeyNodeElement = "element"
+	KeyNodeText    = "text"
+	KeyNodeRaw     = "raw"
+)
+
+// getVoidTags are written as <tag /> and never have children.
+func getVoidTags() []string {
+	return []string{"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr"}
+}
+
+// getVerbatimTags have their content copied byte for byte, since
+// whitespace inside of them is significant.
+func getVerbatimTags() []string {
+	return []string{"pre", "textarea", "script", "style"}
+}
+
+// Node is a piece of a component file. Tag names and attributes keep the
+// case and quoting of the source, which the html package would lose.
+type Node struct {
+	Type        string
+	Tag         string
+	Attrs       []Attr
+	Children    []*Node
+	Text        string // text, or the verbatim source of comments and stray end tags
+	Inner       string // content of verbatim tags
+	EndTag      string // end tag of verbatim tags as written
+	Closed      bool
+	SelfClosing bool
+	Multiline   bool // the content of the element spanned more than one line
+}
+
+type Attr struct {
+	Key    string
+	Val    string
+	HasVal bool
+	Quote  string
+}
+
+// Format rewrites a component file canonically. Elements are indented
+// by four spaces, _component and the other gtml attributes come first,
+// and values are double quoted unless they contain a double quote.
+// Runes are left alone, and the content of <pre>, <textarea>, <script>
+// and <style> is never touched.
+func Format(src []byte) ([]byte, error) {
+	names, err := element.ReadComponentElementNamesFromString(string(src))
+	if err != nil {
+		return nil, err
+	}
+	root, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	var builder strings.Builder
+	first := true
+	for _, child := range root.Children {
+		if isBlankText(child) {
+			continue
+		}
+		if !first && isComponent(child) {
+			builder.WriteString("\n")
+		}
+		first = false
+		writeBlock(&builder, child, 0)
+	}
+	out := builder.String()
+
+	// the element package must still find the same components
+	outNames, err := element.ReadComponentElementNamesFromString(out)
+	if err != nil || strings.Join(outNames, ",") != strings.Join(names, ",") {
+		return nil, fmt.Errorf("formatting changed the components found in the file, it was left as is")
+	}
+	return []byte(out), nil
+}
+
+// Parse reads src into a tree rooted at a nameless element.
+func Parse(src []byte) (*Node, error) {
+	z := html.NewTokenizer(bytes.NewReader(src))
+	root := &Node{Type: KeyNodeElement, Closed: true}
+	stack := []*Node{root}
+	contentStarts := []int{0}
+	offset := 0
+	next := func() (html.TokenType, string, int) {
+		tt := z.Next()
+		raw := string(z.Raw())
+		start := offset
+		offset += len(raw)
+		return tt, raw, start
+	}
+	for {
+		tt, raw, start := next()
+		parent := stack[len(stack)-1]
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				return nil, z.Err()
+			}
+			for i := len(stack) - 1; i > 0; i-- {
+				stack[i].Multiline = strings.Contains(string(src[contentStarts[i]:]), "\n")
+			}
+			return root, nil
+		case html.TextToken:
+			parent.Children = append(parent.Children, &Node{Type: KeyNodeText, Text: raw})
+		case html.CommentToken, html.DoctypeToken:
+			parent.Children = append(parent.Children, &Node{Type: KeyNodeRaw, Text: raw})
+		case html.StartTagToken, html.SelfClosingTagToken:
+			n := parseStartTag(raw)
+			parent.Children = append(parent.Children, n)
+			lower := strings.ToLower(n.Tag)
+			if tt == html.SelfClosingTagToken || containsStr(getVoidTags(), lower) {
+				n.SelfClosing = true
+				n.Closed = true
+				continue
+			}
+			if containsStr(getVerbatimTags(), lower) {
+				// copy everything up to the matching end tag
+				depth := 0
+				for {
+					innerTT, innerRaw, innerStart := next()
+					if innerTT == html.ErrorToken {
+						if z.Err() != io.EOF {
+							return nil, z.Err()
+						}
+						n.Inner = string(src[start+len(raw):])
+						return root, nil
+					}
+					innerName := strings.ToLower(getTagName(innerRaw))
+					if innerTT == html.StartTagToken && innerName == lower {
+						depth++
+					}
+					if innerTT == html.EndTagToken && innerName == lower {
+						if depth == 0 {
+							n.Inner = string(src[start+len(raw) : innerStart])
+							n.EndTag = innerRaw
+							n.Closed = true
+							break
+						}
+						depth--
+					}
+				}
+				continue
+			}
+			stack = append(stack, n)
+			contentStarts = append(contentStarts, offset)
+		case html.EndTagToken:
+			name := strings.ToLower(getTagName(raw))
+			match := -1
+			for i := len(stack) - 1; i > 0; i-- {
+				if strings.ToLower(stack[i].Tag) == name {
+					match = i
+					break
+				}
+			}
+			if match == -1 {
+				parent.Children = append(parent.Children, &Node{Type: KeyNodeRaw, Text: raw})
+				continue
+			}
+			// elements opened after the match were never closed
+			for i := len(stack) - 1; i >= match; i-- {
+				stack[i].Multiline = strings.Contains(string(src[contentStarts[i]:start]), "\n")
+			}
+			stack[match].Closed = true
+			stack = stack[:match]
+			contentStarts = contentStarts[:match]
+		}
+	}
+}
+
+// getTagName reads the name of a start or end tag as written.
+func getTagName(raw string) string {
+	raw = strings.TrimPrefix(raw, "<")
+	raw = strings.TrimPrefix(raw, "/")
+	end := strings.IndexAny(raw, " \t\n\r\f/>")
+	if end == -1 {
+		return raw
+	}
+	return raw[:end]
+}
+
+func parseStartTag(raw string) *Node {
+	n := &Node{
+		Type: KeyNodeElement,
+		Tag:  getTagName(raw),
+	}
+	rest := strings.TrimPrefix(raw, "<"+n.Tag)
+	rest = strings.TrimSuffix(rest, ">")
+	i := 0
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+	}
+	for i < len(rest) {
+		for i < len(rest) && (isSpace(rest[i]) || rest[i] == '/') {
+			i++
+		}
+		if i >= len(rest) {
+			break
+		}
+		keyStart := i
+		for i < len(rest) && !isSpace(rest[i]) && rest[i] != '=' && !(rest[i] == '/' && i == len(rest)-1) {
+			i++
+		}
+		a := Attr{Key: rest[keyStart:i]}
+		for i < len(rest) && isSpace(rest[i]) {
+			i++
+		}
+		if i < len(rest) && rest[i] == '=' {
+			i++
+			for i < len(rest) && isSpace(rest[i]) {
+				i++
+			}
+			a.HasVal = true
+			if i < len(rest) && (rest[i] == '"' || rest[i] == '\'') {
+				a.Quote = string(rest[i])
+				end := strings.IndexByte(rest[i+1:], rest[i])
+				if end == -1 {
+					a.Val = rest[i+1:]
+					i = len(rest)
+				} else {
+					a.Val = rest[i+1 : i+1+end]
+					i = i + 2 + end
+				}
+			} else {
+				valStart := i
+				for i < len(rest) && !isSpace(rest[i]) {
+					i++
+				}
+				a.Val = strings.TrimSuffix(rest[valStart:i], "/")
+			}
+		}
+		n.Attrs = append(n.Attrs, a)
+	}
+	return n
+}
+
+// ##==================================================================
+
+func writeBlock(builder *strings.Builder, n *Node, depth int) {
+	indent := strings.Repeat(KeyIndent, depth)
+	switch n.Type {
+	case KeyNodeText:
+		builder.WriteString(indent + strings.TrimSpace(collapseSpace(n.Text)) + "\n")
+		return
+	case KeyNodeRaw:
+		builder.WriteString(indent + strings.TrimSpace(n.Text) + "\n")
+		return
+	}
+	if n.SelfClosing || isVerbatim(n) || canInline(n) {
+		builder.WriteString(indent + getInline(n) + "\n")
+		return
+	}
+	builder.WriteString(indent + getStartTag(n) + "\n")
+	for _, run := range getRuns(n.Children) {
+		if len(run) == 1 {
+			writeBlock(builder, run[0], depth+1)
+			continue
+		}
+		// nodes without whitespace between them stay on one line, a line
+		// break would add a space to the rendered page
+		var line strings.Builder
+		for _, child := range run {
+			line.WriteString(getInline(child))
+		}
+		builder.WriteString(indent + KeyIndent + strings.TrimSpace(line.String()) + "\n")
+	}
+	if n.Closed {
+		builder.WriteString(indent + "</" + n.Tag + ">\n")
+	}
+}
+
+// getRuns splits children wherever whitespace separates them.
+func getRuns(children []*Node) [][]*Node {
+	runs := make([][]*Node, 0)
+	run := make([]*Node, 0)
+	flush := func() {
+		if len(run) > 0 {
+			runs = append(runs, run)
+			run = make([]*Node, 0)
+		}
+	}
+	for _, child := range children {
+		if isBlankText(child) {
+			flush()
+			continue
+		}
+		if child.Type == KeyNodeText && startsWithSpace(child.Text) {
+			flush()
+		}
+		run = append(run, child)
+		if child.Type == KeyNodeText && endsWithSpace(child.Text) {
+			flush()
+		}
+	}
+	flush()
+	return runs
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.TrimSpace(s[:1]) == ""
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.TrimSpace(s[len(s)-1:]) == ""
+}
+
+// canInline reports whether n was written on a single line, in which
+// case it stays on one.
+func canInline(n *Node) bool {
+	if n.Multiline {
+		return false
+	}
+	for _, child := range n.Children {
+		if child.Type == KeyNodeRaw && strings.Contains(child.Text, "\n") {
+			return false
+		}
+	}
+	return true
+}
+
+func getInline(n *Node) string {
+	switch n.Type {
+	case KeyNodeText:
+		return collapseSpace(n.Text)
+	case KeyNodeRaw:
+		return n.Text
+	}
+	if n.SelfClosing {
+		return strings.TrimSuffix(getStartTag(n), ">") + " />"
+	}
+	if isVerbatim(n) {
+		return getStartTag(n) + n.Inner + n.EndTag
+	}
+	var inner strings.Builder
+	for _, child := range n.Children {
+		inner.WriteString(getInline(child))
+	}
+	out := getStartTag(n) + strings.TrimSpace(collapseSpace(inner.String()))
+	if n.Closed {
+		out += "</" + n.Tag + ">"
+	}
+	return out
+}
+
+func getStartTag(n *Node) string {
+	var builder strings.Builder
+	builder.WriteString("<" + n.Tag)
+	for _, a := range getOrderedAttrs(n.Attrs) {
+		builder.WriteString(" " + a.Key)
+		if !a.HasVal {
+			continue
+		}
+		quote := `"`
+		if strings.Contains(a.Val, `"`) {
+			quote = "'"
+			if strings.Contains(a.Val, "'") {
+				quote = a.Quote
+			}
+		}
+		builder.WriteString("=" + quote + a.Val + quote)
+	}
+	builder.WriteString(">")
+	return builder.String()
+}
+
+// getOrderedAttrs puts _component first, then the other gtml attributes,
+// then everything else. Attributes keep their order within each group.
+func getOrderedAttrs(attrs []Attr) []Attr {
+	ordered := make([]Attr, 0, len(attrs))
+	for _, a := range attrs {
+		if a.Key == "_component" {
+			ordered = append(ordered, a)
+		}
+	}
+	for _, a := range attrs {
+		if a.Key != "_component" && strings.HasPrefix(a.Key, "_") {
+			ordered = append(ordered, a)
+		}
+	}
+	for _, a := range attrs {
+		if !strings.HasPrefix(a.Key, "_") {
+			ordered = append(ordered, a)
+		}
+	}
+	return ordered
+}
+
+func isVerbatim(n *Node) bool {
+	return n.Type == KeyNodeElement && containsStr(getVerbatimTags(), strings.ToLower(n.Tag))
+}
+
+// isComponent reports whether n starts a component, which is set apart
+// from the one before it by a blank line.
+func isComponent(n *Node) bool {
+	for _, a := range n.Attrs {
+		if a.Key == "_component" {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlankText(n *Node) bool {
+	return n.Type == KeyNodeText && strings.TrimSpace(n.Text) == ""
+}
+
+// collapseSpace turns every run of whitespace into a single space.
+func collapseSpace(s string) string {
+	var builder strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			space = true
+			continue
+		}
+		if space {
+			builder.WriteString(" ")
+			space = false
+		}
+		builder.WriteRune(r)
+	}
+	if space {
+		builder.WriteString(" ")
+	}
+	return builder.String()
+}
+
+func containsStr(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package lint
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/gtmlrune"
+	"github.com/phillip-england/gtml/src/parser/param"
+	"github.com/phillip-england/purse"
+	"golang.org/x/net/html"
+)
+
+const (
+	KeyIgnore     = "gtml-lint-ignore"
+	KeyIgnoreFile = "gtml-lint-ignore-file"
+)
+
+// Rule checks a single component. New rules implement Rule and are
+// added to GetRules, the command picks them up from there.
+type Rule interface {
+	GetName() string
+	GetSummary() string
+	Check(file *File, comp *Component) ([]*Diagnostic, error)
+}
+
+func GetRules() []Rule {
+	return []Rule{
+		NewRuleUndefinedVal(),
+		NewRuleUnusedSlot(),
+		NewRuleUnusedProp(),
+		NewRuleMissingProp(),
+		NewRuleElseWithoutIf(),
+	}
+}
+
+func GetRuleNames() []string {
+	names := make([]string, 0)
+	for _, rule := range GetRules() {
+		names = append(names, rule.GetName())
+	}
+	return names
+}
+
+// ##==================================================================
+
+// Diagnostic is a single problem found by a rule.
+type Diagnostic struct {
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	Component string `json:"component"`
+	Rule      string `json:"rule"`
+	Message   string `json:"message"`
+}
+
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s (%s)", d.Path, d.Line, d.Message, d.Rule)
+}
+
+// ##==================================================================
+
+// File is a component file parsed the same way gtml build parses it.
+type File struct {
+	Path       string
+	Src        string
+	Lines      []string
+	CompNames  []string
+	Components []*Component
+}
+
+// Component is a single _component of a File along with what it takes
+// and renders.
+type Component struct {
+	Name    string
+	Element element.Element
+	Params  []param.Param
+	Slots   []string
+	Line    int
+}
+
+func NewFile(path string) (*File, error) {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileFromSrc(path, string(f))
+}
+
+// NewFileFromSrc parses src as though it were the content of path, for
+// files which have unsaved changes in an editor.
+func NewFileFromSrc(path string, src string) (*File, error) {
+	file := &File{
+		Path:  path,
+		Src:   src,
+		Lines: strings.Split(src, "\n"),
+	}
+	err := fungi.Process(
+		func() error { return file.initComponents() },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (file *File) initComponents() error {
+	compNames, err := element.ReadComponentElementNamesFromString(file.Src)
+	if err != nil {
+		return err
+	}
+	file.CompNames = compNames
+	compSels, err := element.ReadComponentSelectionsFromString(file.Src)
+	if err != nil {
+		return err
+	}
+	for _, sel := range compSels {
+		err := element.MarkSelectionPlaceholders(sel, compNames)
+		if err != nil {
+			return err
+		}
+	}
+	element.MarkSelectionsContext(compSels)
+	err = element.MarkSelectionsScopedSlots(compSels)
+	if err != nil {
+		return err
+	}
+	err = element.MarkSelectionsAssets(compSels)
+	if err != nil {
+		return err
+	}
+	element.MarkSelectionsAsUnique(compSels)
+	// fragments are linted as part of their components
+	_, err = element.AddFragmentSelections(compSels, compNames)
+	if err != nil {
+		return err
+	}
+	compElms, err := element.ConvertSelectionsIntoElements(compSels, compNames)
+	if err != nil {
+		return err
+	}
+	for _, elm := range compElms {
+		comp := &Component{
+			Name:    element.GetComponentName(elm),
+			Element: elm,
+		}
+		params, err := param.NewParamsFromElement(elm)
+		if err != nil {
+			return err
+		}
+		comp.Params = params
+		err = WalkComponentNodes(comp, func(sel *goquery.Selection) error {
+			runes, err := GetNodeRunes(sel)
+			if err != nil {
+				return err
+			}
+			for _, rn := range runes {
+				if rn.GetType() == gtmlrune.KeyRuneSlot && !purse.SliceContains(comp.Slots, rn.GetValue()) {
+					comp.Slots = append(comp.Slots, rn.GetValue())
+				}
+			}
+			slot, exists := sel.Attr(element.KeyElementSlotDefault)
+			if exists && !purse.SliceContains(comp.Slots, slot) {
+				comp.Slots = append(comp.Slots, slot)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		comp.Line = file.FindLine(1, "_component=\""+comp.Name+"\"", "_component='"+comp.Name+"'")
+		file.Components = append(file.Components, comp)
+	}
+	return nil
+}
+
+// GetComponent returns the component of the file called name, the same
+// components gtml build resolves placeholders against.
+func (file *File) GetComponent(name string) *Component {
+	for _, comp := range file.Components {
+		if comp.Name == name {
+			return comp
+		}
+	}
+	return nil
+}
+
+// FindLine returns the first line at or after from which contains one
+// of needles, or from when none do. Needles match regardless of case,
+// since goquery lowercases tag and attribute names.
+func (file *File) FindLine(from int, needles ...string) int {
+	for i := from - 1; i < len(file.Lines); i++ {
+		if i < 0 {
+			continue
+		}
+		for _, needle := range needles {
+			if strings.Contains(strings.ToLower(file.Lines[i]), strings.ToLower(needle)) {
+				return i + 1
+			}
+		}
+	}
+	return from
+}
+
+// NewDiagnostic reports msg against the line of comp where one of
+// needles first appears.
+func (file *File) NewDiagnostic(rule Rule, comp *Component, msg string, needles ...string) *Diagnostic {
+	return &Diagnostic{
+		Path:      file.Path,
+		Line:      file.FindLine(comp.Line, needles...),
+		Component: comp.Name,
+		Rule:      rule.GetName(),
+		Message:   msg,
+	}
+}
+
+// IsIgnored reports whether a comment turns off the rule of d, either
+// for the whole file or for the line of d. A line is covered by a
+// comment on the same line or on the line above it.
+func (file *File) IsIgnored(d *Diagnostic) bool {
+	for i, line := range file.Lines {
+		for _, comment := range getComments(line) {
+			fields := strings.Fields(strings.ReplaceAll(comment, ",", " "))
+			if len(fields) < 2 || !purse.SliceContains(fields[1:], d.Rule) {
+				continue
+			}
+			if fields[0] == KeyIgnoreFile {
+				return true
+			}
+			if fields[0] == KeyIgnore && (i+1 == d.Line || i+2 == d.Line) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getComments returns the text of every <!-- --> comment on line.
+func getComments(line string) []string {
+	comments := make([]string, 0)
+	for {
+		start := strings.Index(line, "<!--")
+		if start == -1 {
+			return comments
+		}
+		line = line[start+len("<!--"):]
+		end := strings.Index(line, "-->")
+		if end == -1 {
+			return comments
+		}
+		comments = append(comments, line[:end])
+		line = line[end+len("-->"):]
+	}
+}
+
+// ##==================================================================
+
+// Lint runs rules over every component of the files at paths. The
+// diagnostics come back sorted by file and line.
+func Lint(paths []string, rules []Rule) ([]*Diagnostic, error) {
+	diagnostics := make([]*Diagnostic, 0)
+	for _, path := range paths {
+		file, err := NewFile(path)
+		if err != nil {
+			return diagnostics, fmt.Errorf("%s: %s", path, err.Error())
+		}
+		found, err := LintFile(file, rules)
+		if err != nil {
+			return diagnostics, fmt.Errorf("%s: %s", path, err.Error())
+		}
+		diagnostics = append(diagnostics, found...)
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Path != diagnostics[j].Path {
+			return diagnostics[i].Path < diagnostics[j].Path
+		}
+		return diagnostics[i].Line < diagnostics[j].Line
+	})
+	return diagnostics, nil
+}
+
+// LintFile runs rules over every component of file, leaving out the
+// diagnostics a comment turns off.
+func LintFile(file *File, rules []Rule) ([]*Diagnostic, error) {
+	diagnostics := make([]*Diagnostic, 0)
+	for _, comp := range file.Components {
+		for _, rule := range rules {
+			found, err := rule.Check(file, comp)
+			if err != nil {
+				return diagnostics, err
+			}
+			for _, d := range found {
+				if file.IsIgnored(d) {
+					continue
+				}
+				diagnostics = append(diagnostics, d)
+			}
+		}
+	}
+	return diagnostics, nil
+}
+
+// WalkComponentNodes calls fn for the root of comp and every node in it.
+func WalkComponentNodes(comp *Component, fn func(sel *goquery.Selection) error) error {
+	err := fn(comp.Element.GetSelection())
+	if err != nil {
+		return err
+	}
+	return element.WalkAllElementNodes(comp.Element, fn)
+}
+
+// GetNodeRunes returns the runes in the attributes and the text of sel,
+// leaving out the runes of its children.
+func GetNodeRunes(sel *goquery.Selection) ([]gtmlrune.GtmlRune, error) {
+	node := sel.Get(0)
+	parts := make([]string, 0)
+	for _, a := range node.Attr {
+		parts = append(parts, a.Val)
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			parts = append(parts, child.Data)
+		}
+	}
+	// NewRunesFromStr skips a rune at the very start of the string
+	return gtmlrune.NewRunesFromStr("  " + strings.Join(parts, "  "))
+}
@@ -0,0 +1,273 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/phillip-england/gtml/src/parser/attr"
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/gtmlrune"
+	"github.com/phillip-england/gtml/src/parser/param"
+	"github.com/phillip-england/purse"
+)
+
+// ##==================================================================
+const (
+	KeyRuleUndefinedVal  = "undefined-val"
+	KeyRuleUnusedSlot    = "unused-slot"
+	KeyRuleUnusedProp    = "unused-prop"
+	KeyRuleMissingProp   = "missing-prop"
+	KeyRuleElseWithoutIf = "else-without-if"
+)
+
+// ##==================================================================
+type RuleUndefinedVal struct {
+	Name string
+}
+
+func NewRuleUndefinedVal() *RuleUndefinedVal {
+	return &RuleUndefinedVal{Name: KeyRuleUndefinedVal}
+}
+
+func (rule *RuleUndefinedVal) GetName() string { return rule.Name }
+func (rule *RuleUndefinedVal) GetSummary() string {
+	return "$val(x) where x is neither a prop nor the variable of an enclosing _for"
+}
+
+func (rule *RuleUndefinedVal) Check(file *File, comp *Component) ([]*Diagnostic, error) {
+	diagnostics := make([]*Diagnostic, 0)
+	known := make([]string, 0)
+	for _, p := range comp.Params {
+		known = append(known, p.GetName())
+	}
+	err := WalkComponentNodes(comp, func(sel *goquery.Selection) error {
+		runes, err := GetNodeRunes(sel)
+		if err != nil {
+			return err
+		}
+		loopVars := getLoopVars(sel)
+		for _, rn := range runes {
+			if rn.GetType() != gtmlrune.KeyRuneVal {
+				continue
+			}
+			root := strings.Split(rn.GetValue(), ".")[0]
+			if purse.SliceContains(known, root) || purse.SliceContains(loopVars, root) {
+				continue
+			}
+			msg := fmt.Sprintf("$val(%s) uses %s, which is not a prop, _for or _let variable in scope", rn.GetValue(), root)
+			diagnostics = append(diagnostics, file.NewDiagnostic(rule, comp, msg, "$val("+rn.GetValue()))
+		}
+		return nil
+	})
+	return diagnostics, err
+}
+
+// getLoopVars returns the variables of every _for and _let on sel or
+// around it, along with the item of a scoped slot.
+func getLoopVars(sel *goquery.Selection) []string {
+	vars := make([]string, 0)
+	collect := func(s *goquery.Selection) {
+		if _, scoped := s.Attr(element.KeyElementSlotType); scoped {
+			vars = append(vars, element.KeySlotItem)
+		}
+		lets, _ := element.ReadLets(s)
+		for _, let := range lets {
+			vars = append(vars, let.Name)
+		}
+		forAttr, exists := s.Attr(element.KeyElementFor)
+		if !exists {
+			return
+		}
+		parts := strings.Fields(forAttr)
+		if len(parts) > 0 {
+			vars = append(vars, parts[0])
+		}
+	}
+	collect(sel)
+	sel.Parents().Each(func(i int, parent *goquery.Selection) {
+		collect(parent)
+	})
+	return vars
+}
+
+// ##==================================================================
+type RuleUnusedSlot struct {
+	Name string
+}
+
+func NewRuleUnusedSlot() *RuleUnusedSlot {
+	return &RuleUnusedSlot{Name: KeyRuleUnusedSlot}
+}
+
+func (rule *RuleUnusedSlot) GetName() string { return rule.Name }
+func (rule *RuleUnusedSlot) GetSummary() string {
+	return "a _slot passed to a component which never renders it with $slot"
+}
+
+func (rule *RuleUnusedSlot) Check(file *File, comp *Component) ([]*Diagnostic, error) {
+	diagnostics := make([]*Diagnostic, 0)
+	for _, use := range GetPlaceholderUses(file, comp) {
+		for _, slot := range use.Slots {
+			if purse.SliceContains(use.Target.Slots, slot) {
+				continue
+			}
+			msg := fmt.Sprintf(`%s never renders the _slot "%s" with $slot("%s")`, use.Target.Name, slot, slot)
+			diagnostics = append(diagnostics, file.NewDiagnostic(rule, comp, msg, `_slot="`+slot+`"`, `_slot='`+slot+`'`))
+		}
+	}
+	return diagnostics, nil
+}
+
+// ##==================================================================
+type RuleUnusedProp struct {
+	Name string
+}
+
+func NewRuleUnusedProp() *RuleUnusedProp {
+	return &RuleUnusedProp{Name: KeyRuleUnusedProp}
+}
+
+func (rule *RuleUnusedProp) GetName() string { return rule.Name }
+func (rule *RuleUnusedProp) GetSummary() string {
+	return "an attribute passed to a component which never reads it with $prop"
+}
+
+func (rule *RuleUnusedProp) Check(file *File, comp *Component) ([]*Diagnostic, error) {
+	diagnostics := make([]*Diagnostic, 0)
+	for _, use := range GetPlaceholderUses(file, comp) {
+		params := make([]string, 0)
+		spreads := false
+		for _, p := range use.Target.Params {
+			params = append(params, p.GetName())
+			spreads = spreads || p.GetType() == param.KeyParamAttrsType
+		}
+		// a component with _rest uses every attribute it is passed
+		if spreads {
+			continue
+		}
+		for i, prop := range use.Props {
+			if purse.SliceContains(params, prop) {
+				continue
+			}
+			msg := fmt.Sprintf("%s is passed %s but never uses it", use.Target.Name, use.Keys[i])
+			diagnostics = append(diagnostics, file.NewDiagnostic(rule, comp, msg, " "+use.Keys[i]+"="))
+		}
+	}
+	return diagnostics, nil
+}
+
+// ##==================================================================
+type RuleMissingProp struct {
+	Name string
+}
+
+func NewRuleMissingProp() *RuleMissingProp {
+	return &RuleMissingProp{Name: KeyRuleMissingProp}
+}
+
+func (rule *RuleMissingProp) GetName() string { return rule.Name }
+func (rule *RuleMissingProp) GetSummary() string {
+	return "a component used without one of the props it needs"
+}
+
+func (rule *RuleMissingProp) Check(file *File, comp *Component) ([]*Diagnostic, error) {
+	diagnostics := make([]*Diagnostic, 0)
+	for _, use := range GetPlaceholderUses(file, comp) {
+		for _, p := range use.Target.Params {
+			if purse.SliceContains(use.Props, p.GetName()) || purse.SliceContains(use.Target.Slots, p.GetName()) {
+				continue
+			}
+			// the context is passed along without an attribute, and the
+			// attributes spread with _rest are all optional
+			if p.GetType() == param.KeyParamCtxType || p.GetType() == param.KeyParamAttrsType {
+				continue
+			}
+			msg := fmt.Sprintf("%s needs %s, which is not passed to it", use.Target.Name, p.GetName())
+			diagnostics = append(diagnostics, file.NewDiagnostic(rule, comp, msg, "<"+use.Target.Name, "<"+strings.ToLower(use.Target.Name)))
+		}
+	}
+	return diagnostics, nil
+}
+
+// ##==================================================================
+type RuleElseWithoutIf struct {
+	Name string
+}
+
+func NewRuleElseWithoutIf() *RuleElseWithoutIf {
+	return &RuleElseWithoutIf{Name: KeyRuleElseWithoutIf}
+}
+
+func (rule *RuleElseWithoutIf) GetName() string { return rule.Name }
+func (rule *RuleElseWithoutIf) GetSummary() string {
+	return "an _else which does not directly follow an _if on the same condition"
+}
+
+func (rule *RuleElseWithoutIf) Check(file *File, comp *Component) ([]*Diagnostic, error) {
+	diagnostics := make([]*Diagnostic, 0)
+	err := WalkComponentNodes(comp, func(sel *goquery.Selection) error {
+		cond, exists := sel.Attr(element.KeyElementElse)
+		if !exists {
+			return nil
+		}
+		ifCond, hasIf := sel.Prev().Attr(element.KeyElementIf)
+		if hasIf && purse.Squeeze(ifCond) == purse.Squeeze(cond) {
+			return nil
+		}
+		msg := fmt.Sprintf(`_else="%s" does not follow an _if="%s"`, cond, cond)
+		diagnostics = append(diagnostics, file.NewDiagnostic(rule, comp, msg, `_else="`+cond+`"`, `_else='`+cond+`'`))
+		return nil
+	})
+	return diagnostics, err
+}
+
+// ##==================================================================
+
+// PlaceholderUse is one use of a component inside another.
+type PlaceholderUse struct {
+	Target *Component
+	Keys   []string // attributes as written
+	Props  []string // attributes as the prop names gtml build matches them to
+	Slots  []string
+}
+
+// GetPlaceholderUses finds every placeholder in comp whose component is
+// defined in the same file. Placeholders for components gtml can not
+// see are left to the build to report.
+func GetPlaceholderUses(file *File, comp *Component) []*PlaceholderUse {
+	uses := make([]*PlaceholderUse, 0)
+	_ = WalkComponentNodes(comp, func(sel *goquery.Selection) error {
+		name, exists := sel.Attr(element.KeyElementPlaceholder)
+		if !exists {
+			return nil
+		}
+		target := file.GetComponent(name)
+		if target == nil {
+			return nil
+		}
+		use := &PlaceholderUse{
+			Target: target,
+		}
+		for _, a := range sel.Get(0).Attr {
+			if strings.HasPrefix(a.Key, "_") {
+				continue
+			}
+			prop, err := attr.NewAttr(a.Key, a.Val)
+			if err != nil {
+				continue
+			}
+			use.Keys = append(use.Keys, a.Key)
+			use.Props = append(use.Props, prop.GetKey())
+		}
+		sel.Children().Each(func(i int, child *goquery.Selection) {
+			slot, exists := child.Attr(element.KeyElementSlot)
+			if exists {
+				use.Slots = append(use.Slots, slot)
+			}
+		})
+		uses = append(uses, use)
+		return nil
+	})
+	return uses
+}
@@ -0,0 +1,477 @@
+package lsp
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/phillip-england/gtml/src/lint"
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/gtmlfunc"
+	"github.com/phillip-england/gtml/src/parser/param"
+	"github.com/phillip-england/purse"
+)
+
+const KeyDiagnosticSource = "gtml"
+
+// PanicError is a panic recovered while analysing a document, kept with
+// the stack it was raised on so it can be reported.
+type PanicError struct {
+	Value any
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("gtml panicked: %v\n%s", e.Value, e.Stack)
+}
+
+// GetDiagnostics runs text through the same steps as gtml build, then
+// through the lint rules. Build errors are errors, lint findings are
+// warnings. A panic must not take the server down, so it becomes an
+// error diagnostic and is returned as a *PanicError to be logged.
+func GetDiagnostics(path string, text string) (diagnostics []Diagnostic, err error) {
+	diagnostics = make([]Diagnostic, 0)
+	defer func() {
+		r := recover()
+		if r != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Range:    getLineRange(text, 1),
+				Severity: KeySeverityError,
+				Source:   KeyDiagnosticSource,
+				Message:  fmt.Sprintf("gtml panicked on this file, which is a bug in gtml, the stack is in the gtml lsp log: %v", r),
+			})
+			err = &PanicError{Value: r, Stack: string(debug.Stack())}
+		}
+	}()
+	file, err := lint.NewFileFromSrc(path, text)
+	if err != nil {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    getLineRange(text, 1),
+			Severity: KeySeverityError,
+			Source:   KeyDiagnosticSource,
+			Message:  err.Error(),
+		})
+		return diagnostics, nil
+	}
+	found, err := lint.LintFile(file, lint.GetRules())
+	if err != nil {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    getLineRange(text, 1),
+			Severity: KeySeverityError,
+			Source:   KeyDiagnosticSource,
+			Message:  err.Error(),
+		})
+	}
+	for _, d := range found {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    getLineRange(text, d.Line),
+			Severity: KeySeverityWarning,
+			Code:     d.Rule,
+			Source:   KeyDiagnosticSource,
+			Message:  d.Message,
+		})
+	}
+	for _, comp := range file.Components {
+		err := checkComponentBuild(file, comp)
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Range:    getLineRange(text, comp.Line),
+				Severity: KeySeverityError,
+				Source:   KeyDiagnosticSource,
+				Message:  err.Error(),
+			})
+		}
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Range.Start.Line < diagnostics[j].Range.Start.Line
+	})
+	return diagnostics, nil
+}
+
+// checkComponentBuild generates the Go func of comp, passing it the
+// components it uses as gtml build does, and checks the result parses.
+func checkComponentBuild(file *lint.File, comp *lint.Component) error {
+	siblings := make([]element.Element, 0)
+	for _, dep := range element.ReadPlaceholderNames(comp.Element) {
+		target := file.GetComponent(dep)
+		if target != nil {
+			siblings = append(siblings, target.Element)
+		}
+	}
+	fn, err := gtmlfunc.NewFunc(comp.Element, siblings)
+	if err != nil {
+		return fmt.Errorf("%s: %s", comp.Name, err.Error())
+	}
+	_, err = format.Source([]byte("package gtml\n\n" + fn.GetData()))
+	if err != nil {
+		return fmt.Errorf("the Go generated for %s does not compile: %s", comp.Name, err.Error())
+	}
+	return nil
+}
+
+// ##==================================================================
+
+// Document is a component file as the editor currently sees it.
+type Document struct {
+	Uri  string
+	Path string
+	Text string
+}
+
+// ComponentLocation is a _component found in a Document.
+type ComponentLocation struct {
+	Doc       *Document
+	Component *lint.Component
+}
+
+// GetSignature is the Go func gtml build generates for the component.
+func (loc *ComponentLocation) GetSignature() string {
+	params := make([]string, 0)
+	for _, p := range loc.Component.Params {
+		params = append(params, p.GetStr())
+	}
+	return fmt.Sprintf("func %s(%s) string", loc.Component.Name, strings.Join(params, ", "))
+}
+
+func (loc *ComponentLocation) GetLocation() Location {
+	return Location{
+		Uri:   loc.Doc.Uri,
+		Range: getLineRange(loc.Doc.Text, loc.Component.Line),
+	}
+}
+
+// parseDocument is lint.NewFileFromSrc for text which may be half
+// written, so a parser panic is an error like any other.
+func parseDocument(doc *Document) (file *lint.File, err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			file = nil
+			err = fmt.Errorf("gtml failed to parse %s: %v", doc.Path, r)
+		}
+	}()
+	return lint.NewFileFromSrc(doc.Path, doc.Text)
+}
+
+// findComponentIn returns the component of doc called name. Tag names
+// come back lowercased from the parser, so they match regardless of case.
+func findComponentIn(doc *Document, name string) *ComponentLocation {
+	if !strings.Contains(strings.ToLower(doc.Text), strings.ToLower(name)) {
+		return nil
+	}
+	file, err := parseDocument(doc)
+	if err != nil {
+		return nil
+	}
+	for _, comp := range file.Components {
+		if strings.EqualFold(comp.Name, name) {
+			return &ComponentLocation{Doc: doc, Component: comp}
+		}
+	}
+	return nil
+}
+
+// getWorkspacePaths lists the .html files under root, skipping the same
+// directories gtml graph skips.
+func getWorkspacePaths(root string) []string {
+	paths := make([]string, 0)
+	if root == "" {
+		return paths
+	}
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".html") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths
+}
+
+// ##==================================================================
+
+var tagNameChars = regexp.MustCompile(`^[A-Za-z0-9_-]$`)
+
+// getWordAt returns the run of name characters around offset, with the
+// offset it starts at.
+func getWordAt(text string, offset int) (string, int) {
+	start := offset
+	for start > 0 && tagNameChars.MatchString(text[start-1:start]) {
+		start--
+	}
+	end := offset
+	for end < len(text) && tagNameChars.MatchString(text[end:end+1]) {
+		end++
+	}
+	return text[start:end], start
+}
+
+// getTagAt returns the name of the tag whose name is under offset, as in
+// <Name or </Name, or an empty string when offset is elsewhere.
+func getTagAt(text string, offset int) string {
+	word, start := getWordAt(text, offset)
+	if word == "" {
+		return ""
+	}
+	if strings.HasSuffix(text[:start], "<") || strings.HasSuffix(text[:start], "</") {
+		return word
+	}
+	return ""
+}
+
+var componentAttr = regexp.MustCompile(`_component\s*=\s*["']([^"']*)["']`)
+
+// getComponentAttrAt returns the name given to the _component attribute
+// under offset, or an empty string.
+func getComponentAttrAt(text string, offset int) string {
+	for _, match := range componentAttr.FindAllStringSubmatchIndex(text, -1) {
+		if offset >= match[0] && offset <= match[1] {
+			return text[match[2]:match[3]]
+		}
+	}
+	return ""
+}
+
+// getOpenTag returns the tag name and the text so far of the start tag
+// offset is in, between attributes rather than inside a value.
+func getOpenTag(text string, offset int) (string, string, bool) {
+	before := text[:offset]
+	start := strings.LastIndex(before, "<")
+	if start == -1 || strings.Contains(before[start:], ">") {
+		return "", "", false
+	}
+	inside := before[start+1:]
+	if strings.Count(inside, `"`)%2 != 0 || strings.Count(inside, `'`)%2 != 0 {
+		return "", "", false
+	}
+	fields := strings.Fields(inside)
+	if len(fields) == 0 {
+		return "", "", false
+	}
+	// still writing the tag name itself
+	if len(fields) == 1 && !unicode.IsSpace(rune(before[len(before)-1])) {
+		return "", "", false
+	}
+	return fields[0], inside, true
+}
+
+// getKebabCase turns a prop name into the attribute which sets it, the
+// reverse of what gtml build does with placeholder attributes.
+func getKebabCase(name string) string {
+	var builder strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				builder.WriteRune('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// getPropCompletions offers the props of the component tag is a
+// placeholder for, leaving out the ones already written in the tag.
+func getPropCompletions(loc *ComponentLocation, written string) []CompletionItem {
+	items := make([]CompletionItem, 0)
+	writtenLower := strings.ToLower(written)
+	for _, p := range loc.Component.Params {
+		if purse.SliceContains(loc.Component.Slots, p.GetName()) || p.GetType() == param.KeyParamCtxType || p.GetType() == param.KeyParamAttrsType {
+			continue
+		}
+		attrName := getKebabCase(p.GetName())
+		if strings.Contains(writtenLower, " "+attrName+"=") {
+			continue
+		}
+		items = append(items, CompletionItem{
+			Label:      attrName,
+			Kind:       KeyCompletionProperty,
+			Detail:     p.GetStr(),
+			InsertText: attrName + `=""`,
+		})
+	}
+	return items
+}
+
+// ##==================================================================
+
+var valPath = regexp.MustCompile(`\$val\(\s*([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)\.([A-Za-z0-9_]*)$`)
+
+// getValPathAt returns the variable and the fields already chosen when
+// offset follows $val(x.y., as in x and [y].
+func getValPathAt(text string, offset int) (string, []string, bool) {
+	match := valPath.FindStringSubmatch(text[:offset])
+	if match == nil {
+		return "", nil, false
+	}
+	parts := strings.Split(match[1], ".")
+	return parts[0], parts[1:], true
+}
+
+var forAttr = regexp.MustCompile(`_for\s*=\s*["']\s*([A-Za-z_][A-Za-z0-9_]*)\s+of\s+\S+\s+([^"']+)["']`)
+
+// getLoopType returns the element type of the closest _for before offset
+// which declares name, so []*Guest gives Guest.
+func getLoopType(text string, offset int, name string) string {
+	typeName := ""
+	for _, match := range forAttr.FindAllStringSubmatch(text[:offset], -1) {
+		if match[1] == name {
+			typeName = match[2]
+		}
+	}
+	return getBaseType(typeName)
+}
+
+// getBaseType strips slices, pointers and the package from a type.
+func getBaseType(typeName string) string {
+	typeName = strings.TrimSpace(typeName)
+	typeName = strings.TrimLeft(typeName, "[]*")
+	i := strings.LastIndex(typeName, ".")
+	if i != -1 {
+		typeName = typeName[i+1:]
+	}
+	return typeName
+}
+
+// GoField is a field of a struct in the module.
+type GoField struct {
+	Name string
+	Type string
+}
+
+// getGoStructs reads the fields of every struct type declared in the Go
+// files under moduleDir. Embedded structs add their fields.
+func getGoStructs(moduleDir string) map[string][]GoField {
+	structs := make(map[string][]GoField)
+	if moduleDir == "" {
+		return structs
+	}
+	embeds := make(map[string][]string)
+	fset := token.NewFileSet()
+	_ = filepath.WalkDir(moduleDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != moduleDir && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			spec, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			fields := make([]GoField, 0)
+			for _, field := range st.Fields.List {
+				typeName := exprString(field.Type)
+				if len(field.Names) == 0 {
+					embeds[spec.Name.Name] = append(embeds[spec.Name.Name], getBaseType(typeName))
+					continue
+				}
+				for _, name := range field.Names {
+					if name.IsExported() {
+						fields = append(fields, GoField{Name: name.Name, Type: typeName})
+					}
+				}
+			}
+			structs[spec.Name.Name] = fields
+			return true
+		})
+		return nil
+	})
+	for name, embedded := range embeds {
+		for _, embed := range embedded {
+			structs[name] = append(structs[name], structs[embed]...)
+		}
+	}
+	return structs
+}
+
+// exprString prints a type expression the way it was written.
+func exprString(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.StarExpr:
+		return "*" + exprString(e.X)
+	case *ast.ArrayType:
+		return "[]" + exprString(e.Elt)
+	case *ast.SelectorExpr:
+		return exprString(e.X) + "." + e.Sel.Name
+	case *ast.MapType:
+		return "map[" + exprString(e.Key) + "]" + exprString(e.Value)
+	}
+	return "any"
+}
+
+// getFieldCompletions follows chain from the struct typeName and offers
+// the fields found at the end of it.
+func getFieldCompletions(structs map[string][]GoField, typeName string, chain []string) []CompletionItem {
+	items := make([]CompletionItem, 0)
+	for _, name := range chain {
+		next := ""
+		for _, field := range structs[typeName] {
+			if field.Name == name {
+				next = getBaseType(field.Type)
+			}
+		}
+		if next == "" {
+			return items
+		}
+		typeName = next
+	}
+	for _, field := range structs[typeName] {
+		items = append(items, CompletionItem{
+			Label:  field.Name,
+			Kind:   KeyCompletionField,
+			Detail: field.Type,
+		})
+	}
+	return items
+}
+
+func readDocument(path string) (*Document, error) {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{
+		Uri:  PathToUri(path),
+		Path: path,
+		Text: string(f),
+	}, nil
+}
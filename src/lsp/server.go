@@ -0,0 +1,455 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/phillip-england/gtml/src/graph"
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/purse"
+)
+
+// Server answers LSP requests for component files. Requests are handled
+// one at a time in the order they arrive, which keeps the open documents
+// consistent without any further locking.
+type Server struct {
+	In           *bufio.Reader
+	Out          io.Writer
+	Root         string
+	Docs         map[string]*Document
+	GoStructs    map[string]map[string][]GoField // by module dir, see getModuleStructs
+	WatchGo      bool                            // the client can be asked to report Go file changes
+	ShuttingDown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		In:        bufio.NewReader(in),
+		Out:       out,
+		Docs:      make(map[string]*Document),
+		GoStructs: make(map[string]map[string][]GoField),
+	}
+}
+
+// Run serves until the client sends exit or closes the stream. Exiting
+// without a shutdown first is an error, as the protocol asks.
+func (s *Server) Run() error {
+	for {
+		msg, err := ReadMessage(s.In)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.ShuttingDown {
+				return fmt.Errorf("gtml lsp: exit received before shutdown")
+			}
+			return nil
+		}
+		err = s.handle(msg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *Message) error {
+	if msg.Method == "" {
+		// the client answering a request of ours, which needs nothing
+		// further
+		return nil
+	}
+	isRequest := len(msg.Id) > 0
+	var result any
+	var err error
+	switch msg.Method {
+	case "initialize":
+		result, err = s.initialize(msg.Params)
+	case "initialized":
+		err = s.initialized()
+	case "shutdown":
+		s.ShuttingDown = true
+	case "textDocument/didOpen":
+		err = s.didOpen(msg.Params)
+	case "textDocument/didChange":
+		err = s.didChange(msg.Params)
+	case "textDocument/didSave":
+		err = s.didSave(msg.Params)
+	case "textDocument/didClose":
+		err = s.didClose(msg.Params)
+	case "workspace/didChangeWatchedFiles":
+		err = s.didChangeWatchedFiles(msg.Params)
+	case "textDocument/definition":
+		result, err = s.definition(msg.Params)
+	case "textDocument/completion":
+		result, err = s.completion(msg.Params)
+	case "textDocument/hover":
+		result, err = s.hover(msg.Params)
+	default:
+		if isRequest {
+			return s.reply(msg.Id, nil, &ResponseError{
+				Code:    KeyErrMethodNotFound,
+				Message: "gtml lsp does not support " + msg.Method,
+			})
+		}
+		return nil
+	}
+	if !isRequest {
+		// a notification has nobody to tell about a bad param
+		return nil
+	}
+	if err != nil {
+		return s.reply(msg.Id, nil, &ResponseError{
+			Code:    KeyErrInvalidParams,
+			Message: err.Error(),
+		})
+	}
+	return s.reply(msg.Id, result, nil)
+}
+
+func (s *Server) reply(id json.RawMessage, result any, respErr *ResponseError) error {
+	msg := &Message{Id: id, Error: respErr}
+	if respErr == nil {
+		// a null result has to be sent rather than left out
+		if result == nil {
+			result = json.RawMessage("null")
+		}
+		msg.Result = result
+	}
+	return s.send(msg)
+}
+
+func (s *Server) notify(method string, params any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.send(&Message{Method: method, Params: raw})
+}
+
+// request sends a request to the client. Its answer is not waited for,
+// handle drops it when it arrives.
+func (s *Server) request(id string, method string, params any) error {
+	rawId, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.send(&Message{Id: rawId, Method: method, Params: raw})
+}
+
+func (s *Server) send(msg *Message) error {
+	return WriteMessage(s.Out, msg)
+}
+
+// ##==================================================================
+
+func (s *Server) initialize(raw json.RawMessage) (any, error) {
+	params := &InitializeParams{}
+	err := json.Unmarshal(raw, params)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case params.RootUri != "":
+		s.Root = UriToPath(params.RootUri)
+	case params.RootPath != "":
+		s.Root = params.RootPath
+	}
+	s.WatchGo = params.Capabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync":   1,
+			"definitionProvider": true,
+			"hoverProvider":      true,
+			"completionProvider": map[string]any{
+				"triggerCharacters": []string{".", "<", " "},
+			},
+		},
+		"serverInfo": map[string]string{
+			"name": "gtml",
+		},
+	}, nil
+}
+
+// initialized asks the client to report changes to Go files, which are
+// not open in the editor when they change on a git checkout or a code
+// generator run, so the cached structs do not go stale.
+func (s *Server) initialized() error {
+	if !s.WatchGo {
+		return nil
+	}
+	return s.request("gtml-watch-go", "client/registerCapability", &RegistrationParams{
+		Registrations: []Registration{{
+			Id:     "gtml-watch-go",
+			Method: "workspace/didChangeWatchedFiles",
+			RegisterOptions: map[string]any{
+				"watchers": []FileSystemWatcher{{GlobPattern: "**/*.go"}},
+			},
+		}},
+	})
+}
+
+func (s *Server) didOpen(raw json.RawMessage) error {
+	params := &DidOpenParams{}
+	err := json.Unmarshal(raw, params)
+	if err != nil {
+		return err
+	}
+	// Go files are only followed for the structs they declare
+	if isGoUri(params.TextDocument.Uri) {
+		return nil
+	}
+	doc := &Document{
+		Uri:  params.TextDocument.Uri,
+		Path: UriToPath(params.TextDocument.Uri),
+		Text: params.TextDocument.Text,
+	}
+	s.Docs[doc.Uri] = doc
+	return s.publishDiagnostics(doc)
+}
+
+func (s *Server) didChange(raw json.RawMessage) error {
+	params := &DidChangeParams{}
+	err := json.Unmarshal(raw, params)
+	if err != nil {
+		return err
+	}
+	if isGoUri(params.TextDocument.Uri) {
+		s.dropModuleStructs(UriToPath(params.TextDocument.Uri))
+		return nil
+	}
+	doc := s.Docs[params.TextDocument.Uri]
+	if doc == nil || len(params.ContentChanges) == 0 {
+		return nil
+	}
+	// full sync, so the last change holds the whole document
+	doc.Text = params.ContentChanges[len(params.ContentChanges)-1].Text
+	return s.publishDiagnostics(doc)
+}
+
+func (s *Server) didSave(raw json.RawMessage) error {
+	params := &DidSaveParams{}
+	err := json.Unmarshal(raw, params)
+	if err != nil {
+		return err
+	}
+	if isGoUri(params.TextDocument.Uri) {
+		s.dropModuleStructs(UriToPath(params.TextDocument.Uri))
+		return nil
+	}
+	doc := s.Docs[params.TextDocument.Uri]
+	if doc == nil {
+		return nil
+	}
+	return s.publishDiagnostics(doc)
+}
+
+func (s *Server) didClose(raw json.RawMessage) error {
+	params := &DidCloseParams{}
+	err := json.Unmarshal(raw, params)
+	if err != nil {
+		return err
+	}
+	delete(s.Docs, params.TextDocument.Uri)
+	return s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+		Uri:         params.TextDocument.Uri,
+		Diagnostics: make([]Diagnostic, 0),
+	})
+}
+
+func (s *Server) didChangeWatchedFiles(raw json.RawMessage) error {
+	params := &DidChangeWatchedFilesParams{}
+	err := json.Unmarshal(raw, params)
+	if err != nil {
+		return err
+	}
+	for _, change := range params.Changes {
+		if isGoUri(change.Uri) {
+			s.dropModuleStructs(UriToPath(change.Uri))
+		}
+	}
+	return nil
+}
+
+func (s *Server) publishDiagnostics(doc *Document) error {
+	diagnostics, err := GetDiagnostics(doc.Path, doc.Text)
+	if err != nil {
+		// the stack goes to the log of the client, where it can be found
+		// and reported
+		err = s.notify("window/logMessage", &LogMessageParams{
+			Type:    KeyMessageError,
+			Message: err.Error(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+		Uri:         doc.Uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+// getModuleStructs returns the structs declared in the Go files of
+// moduleDir. Completions ask for them on every keystroke, so they are
+// read once and kept until a Go file of the module is saved, edited or
+// reported changed by the client.
+func (s *Server) getModuleStructs(moduleDir string) map[string][]GoField {
+	structs, ok := s.GoStructs[moduleDir]
+	if !ok {
+		structs = getGoStructs(moduleDir)
+		s.GoStructs[moduleDir] = structs
+	}
+	return structs
+}
+
+// dropModuleStructs forgets the structs of every module holding path, a
+// Go file which changed.
+func (s *Server) dropModuleStructs(path string) {
+	for moduleDir := range s.GoStructs {
+		rel, err := filepath.Rel(moduleDir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			delete(s.GoStructs, moduleDir)
+		}
+	}
+}
+
+func isGoUri(uri string) bool {
+	return strings.HasSuffix(uri, ".go")
+}
+
+// ##==================================================================
+
+// getPositionDoc returns the open document and byte offset a request
+// points at.
+func (s *Server) getPositionDoc(raw json.RawMessage) (*Document, int, error) {
+	params := &TextDocumentPositionParams{}
+	err := json.Unmarshal(raw, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	doc := s.Docs[params.TextDocument.Uri]
+	if doc == nil {
+		return nil, 0, fmt.Errorf("%s is not open", params.TextDocument.Uri)
+	}
+	return doc, getOffset(doc.Text, params.Position), nil
+}
+
+// findComponent looks for the _component called name, first in doc
+// since gtml build resolves placeholders within a file, then in the
+// other open documents, then in the .html files of the workspace.
+func (s *Server) findComponent(doc *Document, name string) *ComponentLocation {
+	if purse.SliceContains(element.GetValidHtmlTags(), strings.ToLower(name)) {
+		return nil
+	}
+	loc := findComponentIn(doc, name)
+	if loc != nil {
+		return loc
+	}
+	for _, other := range s.Docs {
+		if other == doc {
+			continue
+		}
+		loc := findComponentIn(other, name)
+		if loc != nil {
+			return loc
+		}
+	}
+	for _, path := range getWorkspacePaths(s.Root) {
+		if s.Docs[PathToUri(path)] != nil {
+			continue
+		}
+		other, err := readDocument(path)
+		if err != nil {
+			continue
+		}
+		loc := findComponentIn(other, name)
+		if loc != nil {
+			return loc
+		}
+	}
+	return nil
+}
+
+func (s *Server) definition(raw json.RawMessage) (any, error) {
+	doc, offset, err := s.getPositionDoc(raw)
+	if err != nil {
+		return nil, err
+	}
+	name := getTagAt(doc.Text, offset)
+	if name == "" {
+		return nil, nil
+	}
+	loc := s.findComponent(doc, name)
+	if loc == nil {
+		return nil, nil
+	}
+	return loc.GetLocation(), nil
+}
+
+func (s *Server) hover(raw json.RawMessage) (any, error) {
+	doc, offset, err := s.getPositionDoc(raw)
+	if err != nil {
+		return nil, err
+	}
+	name := getTagAt(doc.Text, offset)
+	if name == "" {
+		name = getComponentAttrAt(doc.Text, offset)
+	}
+	if name == "" {
+		return nil, nil
+	}
+	loc := s.findComponent(doc, name)
+	if loc == nil {
+		return nil, nil
+	}
+	return &Hover{
+		Contents: MarkupContent{
+			Kind:  "markdown",
+			Value: fmt.Sprintf("```go\n%s\n```\n\nDefined in %s:%d", loc.GetSignature(), loc.Doc.Path, loc.Component.Line),
+		},
+	}, nil
+}
+
+func (s *Server) completion(raw json.RawMessage) (any, error) {
+	doc, offset, err := s.getPositionDoc(raw)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]CompletionItem, 0)
+	name, chain, ok := getValPathAt(doc.Text, offset)
+	if ok {
+		typeName := getLoopType(doc.Text, offset, name)
+		if typeName == "" {
+			return items, nil
+		}
+		dir := s.Root
+		if dir == "" {
+			dir = "."
+		}
+		moduleDir, err := graph.FindModuleDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		return getFieldCompletions(s.getModuleStructs(moduleDir), typeName, chain), nil
+	}
+	tag, written, ok := getOpenTag(doc.Text, offset)
+	if !ok {
+		return items, nil
+	}
+	loc := s.findComponent(doc, tag)
+	if loc == nil {
+		return items, nil
+	}
+	return getPropCompletions(loc, written), nil
+}
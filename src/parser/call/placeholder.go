@@ -2,10 +2,10 @@ package call
 
 import (
 	"fmt"
-	"gtml/src/parser/gtmlrune"
 	"strings"
 
 	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/gtmlrune"
 	"github.com/phillip-england/purse"
 )
 
@@ -0,0 +1,273 @@
+package element
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/phillip-england/gqpp"
+	"github.com/phillip-england/purse"
+)
+
+// assetRuneRe finds runes, which can not be used in a _scoped style or a
+// _once script as neither is written where the component renders.
+var assetRuneRe = regexp.MustCompile(`\$(prop|val|pipe|slot|ctx)\(`)
+
+// GetScopeClass returns the class the elements of the _component named
+// compName are given when it has a _scoped style. It only depends on the
+// name, so editing the style does not change the markup.
+func GetScopeClass(compName string) string {
+	sum := sha256.Sum256([]byte(compName))
+	return "gtml-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// ReadAssetSelections returns the _scoped styles and _once scripts in sel.
+func ReadAssetSelections(sel *goquery.Selection) *goquery.Selection {
+	return sel.Find("style[" + KeyElementScoped + "], script[" + KeyElementOnce + "]")
+}
+
+// MarkSelectionsAssets prepares the _scoped styles and _once scripts of
+// selections, which are written into the style and script bundles rather
+// than where the component renders. The selectors of a _scoped style are
+// narrowed to the class of its component, which every element of the
+// component is given. The text of each is moved into its _scoped or _once
+// attribute, quoted, so it keeps its newlines when the component is
+// flattened, and is read back with ReadAsset.
+func MarkSelectionsAssets(selections []*goquery.Selection) error {
+	for _, sel := range selections {
+		compName, exists := sel.Attr(KeyElementComponent)
+		if !exists {
+			continue
+		}
+		err := checkAssets(sel)
+		if err != nil {
+			return err
+		}
+		class := GetScopeClass(compName)
+		ReadAssetSelections(sel).Each(func(i int, asset *goquery.Selection) {
+			text := strings.TrimSpace(asset.Text())
+			key := KeyElementOnce
+			if goquery.NodeName(asset) == "style" {
+				text = strings.TrimSpace(ScopeCss(text, class))
+				key = KeyElementScoped
+			}
+			asset.Empty()
+			asset.SetAttr(key, strconv.Quote(text))
+		})
+		if sel.Find("style["+KeyElementScoped+"]").Length() == 0 {
+			continue
+		}
+		all := sel.Find("*").AddSelection(sel)
+		all.Each(func(i int, inner *goquery.Selection) {
+			if gqpp.HasAttr(inner, KeyElementPlaceholder, KeyElementScoped, KeyElementOnce) {
+				return
+			}
+			if _, isMd := inner.Attr(KeyElementMd); isMd {
+				return
+			}
+			// the elements of the <head> are never styled
+			name := goquery.NodeName(inner)
+			if name == "head" || purse.SliceContains(GetHeadTags(), name) {
+				return
+			}
+			current, hasClass := inner.Attr("class")
+			if hasClass && strings.TrimSpace(current) != "" {
+				inner.SetAttr("class", current+" "+class)
+				return
+			}
+			inner.SetAttr("class", class)
+		})
+	}
+	return nil
+}
+
+// ReadAsset returns the text of a _scoped style or _once script marked by
+// MarkSelectionsAssets.
+func ReadAsset(asset *goquery.Selection) string {
+	value, _ := asset.Attr(KeyElementScoped)
+	if goquery.NodeName(asset) == "script" {
+		value, _ = asset.Attr(KeyElementOnce)
+	}
+	text, err := strconv.Unquote(value)
+	if err != nil {
+		return ""
+	}
+	return text
+}
+
+// checkAssets makes sure _scoped is only used on a <style> and _once on a
+// <script>, and that neither holds runes.
+func checkAssets(sel *goquery.Selection) error {
+	var err error
+	sel.Find("[" + KeyElementScoped + "], [" + KeyElementOnce + "]").EachWithBreak(func(i int, inner *goquery.Selection) bool {
+		name := goquery.NodeName(inner)
+		_, scoped := inner.Attr(KeyElementScoped)
+		_, once := inner.Attr(KeyElementOnce)
+		htmlStr, _ := goquery.OuterHtml(inner)
+		if (scoped && name != "style") || (once && name != "script") {
+			err = fmt.Errorf(purse.Fmt(`
+%s found on a <%s>: %s
+%s may only be used on a <style> and %s on a <script>`, attrOf(scoped), name, htmlStr, KeyElementScoped, KeyElementOnce))
+			return false
+		}
+		if _, hasSrc := inner.Attr("src"); hasSrc {
+			err = fmt.Errorf(purse.Fmt(`
+%s found on a <script> with a src: %s
+only inline scripts are collected into the script bundle`, KeyElementOnce, htmlStr))
+			return false
+		}
+		if assetRuneRe.MatchString(inner.Text()) {
+			err = fmt.Errorf(purse.Fmt(`
+rune found in a %s element: %s
+%s styles and %s scripts are written into a bundle, so they can not read props`, attrOf(scoped), htmlStr, KeyElementScoped, KeyElementOnce))
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+func attrOf(scoped bool) string {
+	if scoped {
+		return KeyElementScoped
+	}
+	return KeyElementOnce
+}
+
+// ScopeCss narrows every selector in css to elements with class, by
+// adding the class to the last compound of the selector, so .card h2:hover
+// becomes .card h2.class:hover. The rules within @media, @supports,
+// @container and @layer are scoped as well, while those of other at-rules,
+// such as @keyframes, are left alone.
+func ScopeCss(css string, class string) string {
+	css = stripCssComments(css)
+	var builder strings.Builder
+	rest := css
+	for {
+		open := strings.Index(rest, "{")
+		semi := strings.Index(rest, ";")
+		if open == -1 {
+			builder.WriteString(rest)
+			break
+		}
+		if semi != -1 && semi < open {
+			// a statement such as @import
+			builder.WriteString(rest[:semi+1])
+			rest = rest[semi+1:]
+			continue
+		}
+		close := findCssBlockEnd(rest, open)
+		prelude := strings.TrimSpace(rest[:open])
+		body := rest[open+1 : close]
+		// the whitespace ahead of the rule is kept as it was written
+		builder.WriteString(rest[:strings.Index(rest, prelude)])
+		switch {
+		case isNestingAtRule(prelude):
+			builder.WriteString(prelude + " {" + ScopeCss(body, class) + "}")
+		case strings.HasPrefix(prelude, "@"):
+			builder.WriteString(prelude + " {" + body + "}")
+		default:
+			builder.WriteString(scopeSelectors(prelude, class) + " {" + body + "}")
+		}
+		if close == len(rest) {
+			break
+		}
+		rest = rest[close+1:]
+	}
+	return builder.String()
+}
+
+func isNestingAtRule(prelude string) bool {
+	for _, name := range []string{"@media", "@supports", "@container", "@layer"} {
+		if strings.HasPrefix(prelude, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// findCssBlockEnd returns the index of the } closing the block opened at
+// open, or the length of css when it is never closed.
+func findCssBlockEnd(css string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(css)
+}
+
+func stripCssComments(css string) string {
+	for {
+		start := strings.Index(css, "/*")
+		if start == -1 {
+			return css
+		}
+		end := strings.Index(css[start+2:], "*/")
+		if end == -1 {
+			return css[:start]
+		}
+		css = css[:start] + css[start+2+end+2:]
+	}
+}
+
+// scopeSelectors adds class to each of the comma separated selectors.
+func scopeSelectors(prelude string, class string) string {
+	selectors := splitOutsideQuotes(prelude, ',')
+	for i, selector := range selectors {
+		selectors[i] = scopeSelector(strings.TrimSpace(selector), class)
+	}
+	return strings.Join(selectors, ", ")
+}
+
+// scopeSelector adds class to the last compound of selector, ahead of
+// any pseudo-class or pseudo-element it ends with.
+func scopeSelector(selector string, class string) string {
+	depth := 0
+	compound := 0
+	pseudo := -1
+	for i := 0; i < len(selector); i++ {
+		c := selector[i]
+		switch {
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case depth > 0:
+		case c == ' ' || c == '>' || c == '+' || c == '~':
+			compound = i + 1
+			pseudo = -1
+		case c == ':' && pseudo == -1:
+			pseudo = i
+		}
+	}
+	if compound >= len(selector) {
+		return selector
+	}
+	at := len(selector)
+	if pseudo != -1 {
+		at = pseudo
+	}
+	return selector[:at] + "." + class + selector[at:]
+}
@@ -0,0 +1,190 @@
+package element
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/phillip-england/purse"
+)
+
+// CondAttr is an attribute written only when Cond holds. It comes from
+// _attr:disabled="!canEdit", or from an entry of _class, in which case
+// Name is the class to add.
+type CondAttr struct {
+	Name string
+	Cond string
+}
+
+// ReadCondAttrs returns the _attr: attributes of sel in the order they
+// were written.
+func ReadCondAttrs(sel *goquery.Selection) ([]CondAttr, error) {
+	attrs := make([]CondAttr, 0)
+	if len(sel.Nodes) == 0 {
+		return attrs, nil
+	}
+	for _, a := range sel.Nodes[0].Attr {
+		if !strings.HasPrefix(a.Key, KeyElementAttr) {
+			continue
+		}
+		name := strings.TrimPrefix(a.Key, KeyElementAttr)
+		cond := strings.TrimSpace(a.Val)
+		if name == "" || cond == "" || strings.Contains(cond, "$") {
+			return attrs, fmt.Errorf(purse.Fmt(`
+invalid %s="%s" found
+%sNAME must name the attribute and hold the condition it is written on
+such as %sdisabled="!canEdit"`, a.Key, a.Val, KeyElementAttr, KeyElementAttr))
+		}
+		attrs = append(attrs, CondAttr{Name: name, Cond: cond})
+	}
+	return attrs, nil
+}
+
+// ReadCondClasses returns the classes of the _class attribute of sel,
+// written as { active: isActive, 'text-red': hasError }.
+func ReadCondClasses(sel *goquery.Selection) ([]CondAttr, error) {
+	classes := make([]CondAttr, 0)
+	value, exists := sel.Attr(KeyElementClass)
+	if !exists {
+		return classes, nil
+	}
+	errMsg := purse.Fmt(`
+invalid _class found: %s
+_class maps classes onto the conditions they are added on
+such as _class="{ active: isActive, 'text-red': hasError }"`, value)
+	body := strings.TrimSpace(value)
+	if !strings.HasPrefix(body, "{") || !strings.HasSuffix(body, "}") {
+		return classes, fmt.Errorf(errMsg)
+	}
+	for _, entry := range splitOutsideQuotes(body[1:len(body)-1], ',') {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := splitOutsideQuotes(entry, ':')
+		if len(parts) != 2 {
+			return classes, fmt.Errorf(errMsg)
+		}
+		name := strings.TrimSpace(parts[0])
+		cond := strings.TrimSpace(parts[1])
+		if len(name) > 1 && (name[0] == '\'' || name[0] == '"') && name[len(name)-1] == name[0] {
+			name = name[1 : len(name)-1]
+		}
+		if name == "" || strings.ContainsAny(name, " \t\n\"'") || cond == "" || strings.Contains(cond, "$") {
+			return classes, fmt.Errorf(errMsg)
+		}
+		classes = append(classes, CondAttr{Name: name, Cond: cond})
+	}
+	return classes, nil
+}
+
+// HasAttrDirectives reports if sel has an _attr:, _class or _rest
+// attribute.
+func HasAttrDirectives(sel *goquery.Selection) bool {
+	if len(sel.Nodes) == 0 {
+		return false
+	}
+	for _, a := range sel.Nodes[0].Attr {
+		if a.Key == KeyElementClass || a.Key == KeyElementRest || strings.HasPrefix(a.Key, KeyElementAttr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadAttrDirectiveSelections returns sel and the elements inside it
+// which have an _attr:, _class or _rest attribute and are written by the
+// component of sel. Placeholders pass their attributes on as props, so
+// they and anything inside them, other than their _slot content, are
+// left out.
+func ReadAttrDirectiveSelections(sel *goquery.Selection) []*goquery.Selection {
+	sels := make([]*goquery.Selection, 0)
+	if HasAttrDirectives(sel) {
+		sels = append(sels, sel)
+	}
+	sel.Find("*").Each(func(i int, inner *goquery.Selection) {
+		if !HasAttrDirectives(inner) {
+			return
+		}
+		for s := inner; s.Length() > 0 && !s.IsSelection(sel); s = s.Parent() {
+			if _, isSlot := s.Attr(KeyElementSlot); isSlot {
+				break
+			}
+			if _, isPlaceholder := s.Attr(KeyElementPlaceholder); isPlaceholder {
+				return
+			}
+		}
+		sels = append(sels, inner)
+	})
+	return sels
+}
+
+// ReadCondParams returns the names the conditions of sel rely on which
+// are plain identifiers, like canEdit in !canEdit. They are props of
+// the component in the same way the value of an _if is.
+func ReadCondParams(sel *goquery.Selection) ([]string, error) {
+	names := make([]string, 0)
+	for _, inner := range ReadAttrDirectiveSelections(sel) {
+		attrs, err := ReadCondAttrs(inner)
+		if err != nil {
+			return names, err
+		}
+		classes, err := ReadCondClasses(inner)
+		if err != nil {
+			return names, err
+		}
+		for _, attr := range append(attrs, classes...) {
+			name := strings.TrimSpace(strings.TrimPrefix(attr.Cond, "!"))
+			if !token.IsIdentifier(name) || name == "true" || name == "false" {
+				continue
+			}
+			if !purse.SliceContains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// UsesRest reports if the component of sel writes the attributes passed
+// to it which are not its props, with _rest.
+func UsesRest(sel *goquery.Selection) bool {
+	for _, inner := range ReadAttrDirectiveSelections(sel) {
+		if _, exists := inner.Attr(KeyElementRest); exists {
+			return true
+		}
+	}
+	return false
+}
+
+// splitOutsideQuotes splits value on sep where it is not inside a string
+// or a pair of parens.
+func splitOutsideQuotes(value string, sep rune) []string {
+	parts := make([]string, 0)
+	quote := rune(0)
+	escaped := false
+	depth := 0
+	start := 0
+	for i, ch := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && ch == '\\':
+			escaped = true
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+		case ch == '"' || ch == '`' || ch == '\'':
+			quote = ch
+		case ch == '(' || ch == '[':
+			depth++
+		case ch == ')' || ch == ']':
+			depth--
+		case ch == sep && depth == 0:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
@@ -7,5 +7,75 @@ const (
 	KeyElementElse        = "_else"
 	KeyElementPlaceholder = "_placeholder"
 	KeyElementSlot        = "_slot"
+	KeyElementSlotDefault = "_slot-default"
 	KeyElementMd          = "_md"
 )
+
+// KeySlotChildren names the slot which takes the children of a
+// placeholder that are not wrapped in a _slot, read with
+// $slot("children"). KeyElementSlotImplicit is set by gtml, never written
+// by hand, on the element it wraps them in, which is left out when the
+// slot is written.
+const (
+	KeySlotChildren        = "children"
+	KeyElementSlotImplicit = "_slot-implicit"
+)
+
+// KeyElementSlotType is set by gtml on a _slot passed to a scoped slot,
+// such as $slot("row", Guest), to the type of the item the slot content
+// reads as KeySlotItem.
+const (
+	KeyElementSlotType = "_slot-type"
+	KeySlotItem        = "item"
+)
+
+// KeyElementLet declares local variables on a _component or _for. It
+// does not make an element of its own, so it is not in
+// GetChildElementList.
+const KeyElementLet = "_let"
+
+// KeyElementAttr starts an attribute written only when its condition
+// holds, as in _attr:disabled="!canEdit", KeyElementClass adds classes
+// on conditions and KeyElementRest marks where the attributes passed to
+// a component which are not its props are written. None of them makes
+// an element of its own.
+const (
+	KeyElementAttr  = "_attr:"
+	KeyElementClass = "_class"
+	KeyElementRest  = "_rest"
+)
+
+// KeyElementCtx is set by gtml, never written by hand, on every
+// placeholder whose component reads from the context, so the call to
+// it passes ctx along.
+const KeyElementCtx = "_ctx"
+
+// KeyCtxRune starts the rune which reads from the context. It is kept
+// here as well as in gtmlrune, which imports this package.
+const KeyCtxRune = "$ctx("
+
+// KeyElementHead marks an element, such as a <title> or <meta>, which is
+// moved into the <head> of the document it ends up rendered in. It does
+// not make an element of its own.
+const KeyElementHead = "_head"
+
+// KeyElementScoped marks a <style> whose rules only apply to its
+// _component, and KeyElementOnce a <script> which runs once however many
+// times its _component renders. Both are written into a bundle instead
+// of the markup.
+const (
+	KeyElementScoped = "_scoped"
+	KeyElementOnce   = "_once"
+)
+
+// KeyElementFragment names an element within a _component which gets a
+// func of its own, to render just that part. KeyElementFragmentScope and
+// KeyElementFragmentLet are set by gtml, never written by hand, on the
+// root of the _component made for a fragment. The first lists the
+// variables of the _for and scoped slots around it, which its func takes
+// as params, and the second the _let variables around it.
+const (
+	KeyElementFragment      = "_fragment"
+	KeyElementFragmentScope = "_fragment-scope"
+	KeyElementFragmentLet   = "_fragment-let"
+)
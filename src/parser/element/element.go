@@ -2,14 +2,16 @@ package element
 
 import (
 	"fmt"
-	"gtml/src/parser/attr"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/phillip-england/gqpp"
+	"github.com/phillip-england/gtml/src/parser/attr"
 	"github.com/phillip-england/purse"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 type Element interface {
@@ -40,6 +42,44 @@ func GetValidHtmlTags() []string {
 	}
 }
 
+// tableParents maps the parts of a table onto the element they are
+// parsed within, as they are dropped when parsed on their own.
+var tableParents = map[string]atom.Atom{
+	"caption":  atom.Table,
+	"colgroup": atom.Table,
+	"thead":    atom.Table,
+	"tbody":    atom.Table,
+	"tfoot":    atom.Table,
+	"col":      atom.Colgroup,
+	"tr":       atom.Tbody,
+	"td":       atom.Tr,
+	"th":       atom.Tr,
+}
+
+// newSelectionFromStr parses htmlStr into a selection of its top level
+// elements, like gqpp.NewSelectionFromStr, but keeps a <tr _for> or any
+// other part of a table which starts htmlStr.
+func newSelectionFromStr(htmlStr string) (*goquery.Selection, error) {
+	trimmed := strings.TrimSpace(htmlStr)
+	end := strings.IndexAny(trimmed, " \t\n/>")
+	if !strings.HasPrefix(trimmed, "<") || end == -1 {
+		return gqpp.NewSelectionFromStr(htmlStr)
+	}
+	parentAtom, isTablePart := tableParents[strings.ToLower(trimmed[1:end])]
+	if !isTablePart {
+		return gqpp.NewSelectionFromStr(htmlStr)
+	}
+	parent := &html.Node{Type: html.ElementNode, Data: parentAtom.String(), DataAtom: parentAtom}
+	nodes, err := html.ParseFragment(strings.NewReader(htmlStr), parent)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		parent.AppendChild(node)
+	}
+	return goquery.NewDocumentFromNode(parent).Children(), nil
+}
+
 func GetFullElementList() []string {
 	childElements := GetChildElementList()
 	full := append(childElements, KeyElementComponent)
@@ -49,15 +89,19 @@ func GetFullElementList() []string {
 func GetChildElementList() []string {
 	// KeyElementSlot must go last
 	// other elements take priority over KeyElementSlot
-	return []string{KeyElementFor, KeyElementIf, KeyElementElse, KeyElementPlaceholder, KeyElementMd, KeyElementSlot}
+	return []string{KeyElementFor, KeyElementIf, KeyElementElse, KeyElementPlaceholder, KeyElementMd, KeyElementSlotDefault, KeyElementSlot}
 }
 
 func NewElement(htmlStr string, compNames []string) (Element, error) {
-	sel, err := gqpp.NewSelectionFromStr(htmlStr)
+	sel, err := newSelectionFromStr(htmlStr)
 	if err != nil {
 		return nil, err
 	}
 	match := gqpp.GetFirstMatchingAttr(sel, GetFullElementList()...)
+	if IsFragment(sel) {
+		// the _for or _if of a fragment is left for the component using it
+		match = KeyElementComponent
+	}
 	switch match {
 	case KeyElementComponent:
 		elm, err := NewComponent(htmlStr, sel, compNames)
@@ -95,6 +139,12 @@ func NewElement(htmlStr string, compNames []string) (Element, error) {
 			return nil, err
 		}
 		return elm, nil
+	case KeyElementSlotDefault:
+		elm, err := NewSlotDefault(htmlStr, sel, compNames)
+		if err != nil {
+			return nil, err
+		}
+		return elm, nil
 	case KeyElementSlot:
 		elm, err := NewSlot(htmlStr, sel, compNames)
 		if err != nil {
@@ -276,7 +326,7 @@ func WalkAllElementNodesWithoutChildren(elm Element, fn func(sel *goquery.Select
 	if err != nil {
 		return err
 	}
-	sel, err := gqpp.NewSelectionFromStr(htmlNoChildren)
+	sel, err := newSelectionFromStr(htmlNoChildren)
 	if err != nil {
 		return err
 	}
@@ -314,9 +364,14 @@ func ExtractComponentStringsFromFile(fStr string) ([]string, error) {
 	lines := purse.MakeLines(fStr)
 	compStrs := make([]string, 0)
 	currentComp := make([]string, 0)
+	preformatted := false
 	for i, line := range lines {
-		// push the line
-		line = purse.TrimLeadingSpaces(line)
+		// push the line, the leading spaces within a <pre> or <textarea>
+		// are part of its text
+		if !preformatted {
+			line = purse.TrimLeadingSpaces(line)
+		}
+		preformatted = isPreformattedAfter(preformatted, line)
 		currentComp = append(currentComp, line)
 		// on last line
 		if i == len(lines)-1 {
@@ -335,12 +390,15 @@ func ExtractComponentStringsFromFile(fStr string) ([]string, error) {
 }
 
 func ReadComponentSelectionsFromFile(path string) ([]*goquery.Selection, error) {
-	selections := make([]*goquery.Selection, 0)
 	f, err := os.ReadFile(path)
 	if err != nil {
-		return selections, err
+		return make([]*goquery.Selection, 0), err
 	}
-	fStr := string(f)
+	return ReadComponentSelectionsFromString(string(f))
+}
+
+func ReadComponentSelectionsFromString(fStr string) ([]*goquery.Selection, error) {
+	selections := make([]*goquery.Selection, 0)
 	compStrs, err := ExtractComponentStringsFromFile(fStr)
 	if err != nil {
 		return selections, err
@@ -377,12 +435,15 @@ func ConvertSelectionsIntoElements(selections []*goquery.Selection, compNames []
 }
 
 func ReadComponentElementNamesFromFile(path string) ([]string, error) {
-	names := make([]string, 0)
 	f, err := os.ReadFile(path)
 	if err != nil {
-		return names, err
+		return make([]string, 0), err
 	}
-	fStr := string(f)
+	return ReadComponentElementNamesFromString(string(f))
+}
+
+func ReadComponentElementNamesFromString(fStr string) ([]string, error) {
+	names := make([]string, 0)
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(fStr))
 	if err != nil {
 		return names, err
@@ -391,21 +452,9 @@ func ReadComponentElementNamesFromFile(path string) ([]string, error) {
 	doc.Find("*").Each(func(i int, sel *goquery.Selection) {
 		compAttr, exists := sel.Attr(KeyElementComponent)
 		if exists {
-			if purse.Squeeze(compAttr) == "" {
-				potErr = fmt.Errorf(`you have a _component which does not have a name`)
-				return
-			}
-			firstChar := string(compAttr[0])
-			if !purse.EnforeWhitelist(firstChar, purse.GetAllUpperCaseLetters()) {
-				potErr = fmt.Errorf(`change the first letter in the _component named %s to uppercase`, compAttr)
-				return
-			}
-			if !purse.EnforeWhitelist(compAttr, purse.GetAllLetters()) {
-				potErr = fmt.Errorf(`a _component may only contain letters in it's name, this is an invalid name: %s`, compAttr)
-				return
-			}
-			if purse.MustEqualOneOf(strings.ToLower(compAttr), GetValidHtmlTags()...) {
-				potErr = fmt.Errorf(`a _component may not be named %s as it is a valid HTML tag name, please try a different name`, compAttr)
+			err := checkFuncName(KeyElementComponent, compAttr)
+			if err != nil {
+				potErr = err
 				return
 			}
 			names = append(names, compAttr)
@@ -428,6 +477,51 @@ func ReadComponentElementNamesFromFile(path string) ([]string, error) {
 	return names, nil
 }
 
+// checkFuncName makes sure name, given by directive, can name the Go
+// func generated for it.
+func checkFuncName(directive string, name string) error {
+	if purse.Squeeze(name) == "" {
+		return fmt.Errorf(`you have a %s which does not have a name`, directive)
+	}
+	firstChar := string(name[0])
+	if !purse.EnforeWhitelist(firstChar, purse.GetAllUpperCaseLetters()) {
+		return fmt.Errorf(`change the first letter in the %s named %s to uppercase`, directive, name)
+	}
+	if !purse.EnforeWhitelist(name, purse.GetAllLetters()) {
+		return fmt.Errorf(`a %s may only contain letters in it's name, this is an invalid name: %s`, directive, name)
+	}
+	if purse.MustEqualOneOf(strings.ToLower(name), GetValidHtmlTags()...) {
+		return fmt.Errorf(`a %s may not be named %s as it is a valid HTML tag name, please try a different name`, directive, name)
+	}
+	return nil
+}
+
+func ReadMdPathsFromFile(path string) ([]string, error) {
+	paths := make([]string, 0)
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return paths, err
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(f)))
+	if err != nil {
+		return paths, err
+	}
+	doc.Find("*").Each(func(i int, sel *goquery.Selection) {
+		mdPath, exists := sel.Attr(KeyElementMd)
+		if !exists || purse.Squeeze(mdPath) == "" {
+			return
+		}
+		// gtmlMd resolves paths relative to the working directory
+		if !strings.HasPrefix(mdPath, ".") {
+			mdPath = "." + mdPath
+		}
+		if !purse.SliceContains(paths, mdPath) {
+			paths = append(paths, mdPath)
+		}
+	})
+	return paths, nil
+}
+
 func MarkSelectionPlaceholders(sel *goquery.Selection, compNames []string) error {
 	ogSelHtml, err := gqpp.NewHtmlFromSelection(sel)
 	if err != nil {
@@ -447,22 +541,44 @@ func MarkSelectionPlaceholders(sel *goquery.Selection, compNames []string) error
 	return potErr
 }
 
+// WrapImplicitSlot moves the children of the placeholder sel which are
+// not wrapped in a _slot into one element, so they are passed as the
+// children slot. Whitespace alone is not wrapped.
+func WrapImplicitSlot(sel *goquery.Selection) {
+	loose := make([]*html.Node, 0)
+	found := false
+	sel.Contents().Each(func(i int, child *goquery.Selection) {
+		node := child.Get(0)
+		if _, isSlot := child.Attr(KeyElementSlot); isSlot && node.Type == html.ElementNode {
+			return
+		}
+		switch node.Type {
+		case html.ElementNode:
+			found = true
+		case html.TextNode:
+			found = found || strings.TrimSpace(node.Data) != ""
+		default:
+			return
+		}
+		loose = append(loose, node)
+	})
+	if !found {
+		return
+	}
+	sel.AppendHtml(fmt.Sprintf(`<div %s="%s" %s></div>`, KeyElementSlot, KeySlotChildren, KeyElementSlotImplicit))
+	wrapper := sel.Children().Last()
+	for _, node := range loose {
+		node.Parent.RemoveChild(node)
+		wrapper.Get(0).AppendChild(node)
+	}
+}
+
 func MarkSelectionAsPlaceholder(inner *goquery.Selection, compNames []string, ogSelHtml string) error {
 	innerNodeName := goquery.NodeName(inner)
 	for _, compName := range compNames {
 		if strings.ToLower(compName) == innerNodeName {
 			inner.SetAttr("_placeholder", compName)
-			// var potErr error
-			// inner.Children().Each(func(i int, childSel *goquery.Selection) {
-			// 	_, hasSlot := childSel.Attr("_slot")
-			// 	if !hasSlot {
-			// 		potErr = fmt.Errorf("_placeholder element has children which are not wrapped in an element with a _slot='slotName' attribute: %s", ogSelHtml)
-			// 		return
-			// 	}
-			// })
-			// if potErr != nil {
-			// 	return potErr
-			// }
+			WrapImplicitSlot(inner)
 		}
 	}
 	return nil
@@ -479,21 +595,11 @@ func MarkElementPlaceholders(elm Element) (Element, error) {
 		for _, name := range elm.GetCompNames() {
 			if strings.ToLower(name) == nodeName {
 				sel.SetAttr("_placeholder", name)
+				WrapImplicitSlot(sel)
 				selHtml, err := gqpp.NewHtmlFromSelection(sel)
 				if err != nil {
 					return err
 				}
-				var potErr error
-				sel.Children().Each(func(i int, childSel *goquery.Selection) {
-					_, hasSlot := childSel.Attr("_slot")
-					if !hasSlot {
-						potErr = fmt.Errorf("placeholder element has children which are not wrapped in an element with a _slot='slotName' attribute: %s", ogSelHtml)
-						return
-					}
-				})
-				if potErr != nil {
-					return potErr
-				}
 				clay = strings.Replace(clay, ogSelHtml, selHtml, 1)
 			}
 		}
@@ -509,6 +615,90 @@ func MarkElementPlaceholders(elm Element) (Element, error) {
 	return newElm, nil
 }
 
+// GetComponentName returns the _component name of elm, which differs
+// from GetAttr when the root of a _component is also a _placeholder.
+func GetComponentName(elm Element) string {
+	name, _ := elm.GetSelection().Attr(KeyElementComponent)
+	return name
+}
+
+// ReadPlaceholderNames returns the names of the components elm uses as
+// placeholders, in document order and without duplicates.
+func ReadPlaceholderNames(elm Element) []string {
+	return readSelectionPlaceholderNames(elm.GetSelection())
+}
+
+func readSelectionPlaceholderNames(sel *goquery.Selection) []string {
+	names := make([]string, 0)
+	collect := func(inner *goquery.Selection) {
+		name, exists := inner.Attr(KeyElementPlaceholder)
+		if exists && !purse.SliceContains(names, name) {
+			names = append(names, name)
+		}
+	}
+	collect(sel)
+	sel.Find("*").Each(func(i int, inner *goquery.Selection) {
+		collect(inner)
+	})
+	return names
+}
+
+// MarkSelectionsContext finds the components of a file which need a
+// context.Context, the ones using $ctx along with every component which
+// uses one of those as a placeholder, and marks the placeholders for
+// them with _ctx. Call it after MarkSelectionPlaceholders.
+func MarkSelectionsContext(selections []*goquery.Selection) {
+	needsCtx := make(map[string]bool)
+	for {
+		changed := false
+		for _, sel := range selections {
+			name, _ := sel.Attr(KeyElementComponent)
+			if needsCtx[name] {
+				continue
+			}
+			selHtml, err := goquery.OuterHtml(sel)
+			if err != nil {
+				continue
+			}
+			uses := strings.Contains(selHtml, KeyCtxRune)
+			for _, target := range readSelectionPlaceholderNames(sel) {
+				uses = uses || needsCtx[target]
+			}
+			if uses {
+				needsCtx[name] = true
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	for _, sel := range selections {
+		mark := func(inner *goquery.Selection) {
+			target, exists := inner.Attr(KeyElementPlaceholder)
+			if exists && needsCtx[target] {
+				inner.SetAttr(KeyElementCtx, "")
+			}
+		}
+		mark(sel)
+		sel.Find("*").Each(func(i int, inner *goquery.Selection) {
+			mark(inner)
+		})
+	}
+}
+
+// UsesContext reports whether the component elm takes a context, either
+// to read from it or to pass it on to a placeholder.
+func UsesContext(elm Element) bool {
+	if strings.Contains(elm.GetHtml(), KeyCtxRune) {
+		return true
+	}
+	if _, exists := elm.GetSelection().Attr(KeyElementCtx); exists {
+		return true
+	}
+	return elm.GetSelection().Find("["+KeyElementCtx+"]").Length() > 0
+}
+
 func MarkSelectionAsUnique(sel *goquery.Selection) {
 	id := 0
 	sel.SetAttr("_id", strconv.Itoa(id))
@@ -0,0 +1,230 @@
+package element
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/phillip-england/gqpp"
+	"github.com/phillip-england/purse"
+)
+
+// fragmentPropRe finds the names read with $prop in a _component.
+var fragmentPropRe = regexp.MustCompile(`\$prop\(\s*["']?([A-Za-z]+)`)
+
+// ScopeVar is a variable a fragment reads from around it, such as the
+// item of the _for it sits in, and so takes as a param.
+type ScopeVar struct {
+	Name string
+	Type string
+}
+
+// AddFragmentSelections returns selections along with a _component for
+// every _fragment within them, so each fragment gets a func of its own.
+// It is called once the selections are marked as unique, so a fragment
+// renders the same markup as the _component it came from.
+func AddFragmentSelections(selections []*goquery.Selection, compNames []string) ([]*goquery.Selection, error) {
+	out := make([]*goquery.Selection, 0, len(selections))
+	out = append(out, selections...)
+	names := make([]string, 0)
+	names = append(names, compNames...)
+	for _, sel := range selections {
+		compName, _ := sel.Attr(KeyElementComponent)
+		if _, exists := sel.Attr(KeyElementFragment); exists {
+			return nil, fmt.Errorf(purse.Fmt(`
+_fragment found on the root of the _component %s
+the func of a _component already renders all of it`, compName))
+		}
+		var potErr error
+		sel.Find("[" + KeyElementFragment + "]").EachWithBreak(func(i int, inner *goquery.Selection) bool {
+			name, _ := inner.Attr(KeyElementFragment)
+			err := checkFuncName(KeyElementFragment, name)
+			if err == nil && purse.SliceContains(names, name) {
+				err = fmt.Errorf(`you have more than one _component or _fragment named %s`, name)
+			}
+			if err == nil && gqpp.HasAttr(inner, KeyElementPlaceholder, KeyElementMd) {
+				htmlStr, _ := goquery.OuterHtml(inner)
+				err = fmt.Errorf(purse.Fmt(`
+_fragment found on a placeholder or _md element in _component %s: %s
+wrap the element in another to make a fragment of it`, compName, htmlStr))
+			}
+			if err != nil {
+				potErr = err
+				return false
+			}
+			names = append(names, name)
+			out = append(out, newFragmentSelection(inner, name))
+			return true
+		})
+		if potErr != nil {
+			return nil, potErr
+		}
+	}
+	return out, nil
+}
+
+// newFragmentSelection copies the fragment sel into a _component named
+// name, which declares the _let variables around it and takes the
+// variables of the _for and scoped slots around it as params.
+func newFragmentSelection(sel *goquery.Selection, name string) *goquery.Selection {
+	vars := ReadFragmentScope(sel)
+	lets := make([]string, 0)
+	collect := func(s *goquery.Selection) {
+		value, exists := s.Attr(KeyElementLet)
+		if exists && strings.TrimSpace(value) != "" {
+			lets = append(lets, strings.TrimSuffix(strings.TrimSpace(value), ";"))
+		}
+	}
+	parents := getScopeParents(sel)
+	for _, parent := range parents {
+		collect(parent)
+	}
+	// the props and such the _let variables are made from are taken as
+	// params as well, as the fragment has none of its _component
+	if len(lets) > 0 && len(parents) > 0 {
+		used := readIdents(strings.Join(lets, "; "))
+		for _, v := range readComponentVars(parents[0]) {
+			if purse.SliceContains(used, v.Name) && !hasScopeVar(vars, v.Name) {
+				vars = append(vars, v)
+			}
+		}
+	}
+	clone := sel.Clone()
+	clone.SetAttr(KeyElementComponent, name)
+	scope := make([]string, 0, len(vars))
+	for _, v := range vars {
+		scope = append(scope, v.Name+" "+v.Type)
+	}
+	clone.SetAttr(KeyElementFragmentScope, strings.Join(scope, "; "))
+	if len(lets) > 0 {
+		clone.SetAttr(KeyElementFragmentLet, strings.Join(lets, "; "))
+	}
+	return clone
+}
+
+// readComponentVars returns the props of the _component sel along with
+// the slices it loops over and the conditions of its _if and _else.
+func readComponentVars(sel *goquery.Selection) []ScopeVar {
+	vars := make([]ScopeVar, 0)
+	add := func(v ScopeVar) {
+		if !hasScopeVar(vars, v.Name) {
+			vars = append(vars, v)
+		}
+	}
+	htmlStr, _ := goquery.OuterHtml(sel)
+	for _, match := range fragmentPropRe.FindAllStringSubmatch(html.UnescapeString(htmlStr), -1) {
+		add(ScopeVar{Name: match[1], Type: "string"})
+	}
+	sel.Find("[" + KeyElementFor + "]").Each(func(i int, inner *goquery.Selection) {
+		forAttr, _ := inner.Attr(KeyElementFor)
+		parts := strings.Fields(forAttr)
+		if len(parts) == 4 && !strings.Contains(parts[2], ".") {
+			add(ScopeVar{Name: parts[2], Type: parts[3]})
+		}
+	})
+	sel.Find("[" + KeyElementIf + "], [" + KeyElementElse + "]").Each(func(i int, inner *goquery.Selection) {
+		cond := gqpp.GetFirstMatchingAttr(inner, KeyElementIf, KeyElementElse)
+		value, _ := inner.Attr(cond)
+		add(ScopeVar{Name: value, Type: "bool"})
+	})
+	return vars
+}
+
+// readIdents returns the identifiers in the Go code src.
+func readIdents(src string) []string {
+	idents := make([]string, 0)
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", fset.Base(), len(src)), []byte(src), nil, 0)
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return idents
+		}
+		if tok == token.IDENT {
+			idents = append(idents, lit)
+		}
+	}
+}
+
+func hasScopeVar(vars []ScopeVar, name string) bool {
+	for _, v := range vars {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFragment reports whether sel is the root of a _component made for a
+// fragment.
+func IsFragment(sel *goquery.Selection) bool {
+	_, exists := sel.Attr(KeyElementFragmentScope)
+	return exists
+}
+
+// IsFragmentMarker reports whether key is an attribute gtml sets on the
+// root of a fragment, which is left out when the root is written so it
+// matches the element the fragment was made from.
+func IsFragmentMarker(key string) bool {
+	return key == KeyElementComponent || key == KeyElementFragmentScope || key == KeyElementFragmentLet
+}
+
+// ReadFragmentScope returns the variables sel reads from the _for and
+// scoped slots around it, or from its own _for, outermost first.
+func ReadFragmentScope(sel *goquery.Selection) []ScopeVar {
+	vars := make([]ScopeVar, 0)
+	collect := func(s *goquery.Selection) {
+		if itemType, scoped := s.Attr(KeyElementSlotType); scoped {
+			vars = append(vars, ScopeVar{Name: KeySlotItem, Type: itemType})
+		}
+		forAttr, exists := s.Attr(KeyElementFor)
+		if !exists {
+			return
+		}
+		parts := strings.Fields(forAttr)
+		if len(parts) == 4 {
+			vars = append(vars, ScopeVar{Name: parts[0], Type: strings.TrimPrefix(parts[3], "[]")})
+		}
+	}
+	for _, parent := range getScopeParents(sel) {
+		collect(parent)
+	}
+	collect(sel)
+	return vars
+}
+
+// getScopeParents returns the parents of sel up to the _component it is
+// in, outermost first.
+func getScopeParents(sel *goquery.Selection) []*goquery.Selection {
+	parents := make([]*goquery.Selection, 0)
+	for parent := sel.Parent(); parent.Length() > 0; parent = parent.Parent() {
+		parents = append([]*goquery.Selection{parent}, parents...)
+		if _, isComp := parent.Attr(KeyElementComponent); isComp {
+			break
+		}
+	}
+	return parents
+}
+
+// ReadFragmentScopeParams returns the variables listed in the
+// _fragment-scope of sel, which AddFragmentSelections set.
+func ReadFragmentScopeParams(sel *goquery.Selection) []ScopeVar {
+	vars := make([]ScopeVar, 0)
+	value, exists := sel.Attr(KeyElementFragmentScope)
+	if !exists {
+		return vars
+	}
+	for _, part := range strings.Split(value, ";") {
+		fields := strings.SplitN(strings.TrimSpace(part), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		vars = append(vars, ScopeVar{Name: fields[0], Type: fields[1]})
+	}
+	return vars
+}
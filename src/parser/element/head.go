@@ -0,0 +1,15 @@
+package element
+
+import "github.com/PuerkitoBio/goquery"
+
+// GetHeadTags returns the tags which may be marked with _head.
+func GetHeadTags() []string {
+	return []string{"title", "meta", "link", "script", "style", "base", "noscript"}
+}
+
+// IsDocument reports whether elm renders a whole page, which it does
+// when its root is <html>. A document is written with a doctype and
+// gathers the _head elements rendered within it into its <head>.
+func IsDocument(elm Element) bool {
+	return goquery.NodeName(elm.GetSelection()) == "html"
+}
@@ -0,0 +1,82 @@
+package element
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/phillip-england/purse"
+)
+
+// Let is a local variable declared by a _let attribute, as in
+// _let='fullName = user.FirstName + " " + user.LastName'. Several may be
+// declared in one attribute, separated by ;.
+type Let struct {
+	Name string
+	Expr string
+}
+
+// ReadLets returns the variables declared by the _let attribute of sel,
+// in the order they were written. The root of a fragment declares the
+// _let variables around the fragment first.
+func ReadLets(sel *goquery.Selection) ([]Let, error) {
+	lets := make([]Let, 0)
+	for _, key := range []string{KeyElementFragmentLet, KeyElementLet} {
+		value, exists := sel.Attr(key)
+		if !exists {
+			continue
+		}
+		parsed, err := parseLets(value)
+		if err != nil {
+			return lets, err
+		}
+		lets = append(lets, parsed...)
+	}
+	return lets, nil
+}
+
+func parseLets(value string) ([]Let, error) {
+	lets := make([]Let, 0)
+	for _, decl := range splitOutsideQuotes(value, ';') {
+		decl = strings.TrimSpace(decl)
+		if decl == "" {
+			continue
+		}
+		i := strings.Index(decl, "=")
+		if i == -1 || strings.HasPrefix(decl[i:], "==") {
+			return lets, fmt.Errorf(getLetErr(value))
+		}
+		name := strings.TrimSpace(strings.TrimSuffix(decl[:i], ":"))
+		expr := strings.TrimSpace(decl[i+1:])
+		if !token.IsIdentifier(name) || expr == "" {
+			return lets, fmt.Errorf(getLetErr(value))
+		}
+		lets = append(lets, Let{Name: name, Expr: expr})
+	}
+	return lets, nil
+}
+
+// ReadLetNames returns the names of every variable declared with _let on
+// sel or anywhere inside it.
+func ReadLetNames(sel *goquery.Selection) []string {
+	names := make([]string, 0)
+	collect := func(inner *goquery.Selection) {
+		lets, _ := ReadLets(inner)
+		for _, let := range lets {
+			names = append(names, let.Name)
+		}
+	}
+	collect(sel)
+	sel.Find("*").Each(func(i int, inner *goquery.Selection) {
+		collect(inner)
+	})
+	return names
+}
+
+func getLetErr(value string) string {
+	return purse.Fmt(`
+invalid _let found: %s
+_let declares variables as name = expression, separated by ;
+for example _let='fullName = user.FirstName + " " + user.LastName'`, value)
+}
@@ -2,11 +2,11 @@ package element
 
 import (
 	"fmt"
-	"gtml/src/parser/attr"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/phillip-england/fungi"
 	"github.com/phillip-england/gqpp"
+	"github.com/phillip-england/gtml/src/parser/attr"
 	"github.com/phillip-england/purse"
 )
 
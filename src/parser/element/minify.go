@@ -0,0 +1,169 @@
+package element
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/phillip-england/purse"
+	"golang.org/x/net/html"
+)
+
+// keptLineBreak stands in for a line break within a <pre> or <textarea>
+// once the selections are minified, as the markup of an element has its
+// line breaks removed each time it is rendered. RestoreLineBreaks writes
+// it back as &#10;. keptRawLineBreak does the same within a <script> or
+// <style>, whose text is not decoded, so it is written back as a line
+// break.
+const (
+	keptLineBreak    = "\uE000"
+	keptRawLineBreak = "\uE001"
+)
+
+// whitespaceRe matches a run of the whitespace html collapses.
+var whitespaceRe = regexp.MustCompile(`[ \t\n\r\f]+`)
+
+// preformattedTagRe matches the start and end tags of a <pre> or a
+// <textarea>.
+var preformattedTagRe = regexp.MustCompile(`(?i)<(/?)(pre|textarea)[\s>]`)
+
+// isPreformattedAfter reports whether a <pre> or <textarea> is still open
+// at the end of line, given whether one was open at its start.
+func isPreformattedAfter(preformatted bool, line string) bool {
+	for _, match := range preformattedTagRe.FindAllStringSubmatch(line, -1) {
+		preformatted = match[1] == ""
+	}
+	return preformatted
+}
+
+// GetPreformattedTags returns the elements whose text is written as it
+// is, which minifying leaves alone.
+func GetPreformattedTags() []string {
+	return []string{"pre", "textarea", "script", "style"}
+}
+
+// GetBlockTags returns the elements which are laid out on lines of their
+// own, so the whitespace between them and the text next to them is never
+// rendered. Any other element, including placeholders, is taken to be
+// inline.
+func GetBlockTags() []string {
+	return []string{
+		"address", "article", "aside", "base", "blockquote", "body", "caption", "col", "colgroup",
+		"dd", "details", "dialog", "div", "dl", "dt", "fieldset", "figcaption", "figure", "footer",
+		"form", "h1", "h2", "h3", "h4", "h5", "h6", "head", "header", "hgroup", "hr", "html", "legend",
+		"li", "link", "main", "menu", "meta", "nav", "noscript", "ol", "optgroup", "option", "p",
+		"pre", "script", "section", "source", "style", "summary", "table", "tbody", "td", "template",
+		"tfoot", "th", "thead", "title", "tr", "track", "ul",
+	}
+}
+
+// MinifySelections removes the comments from selections and collapses
+// their whitespace the way a browser would when rendering them. Runs of
+// whitespace become a single space, and whitespace next to the start or
+// end of a block element is dropped. The text of a <pre>, <textarea>,
+// <script> or <style> keeps its whitespace, so a // comment in a script
+// still ends at its line, and _md elements are left alone.
+func MinifySelections(selections []*goquery.Selection) {
+	for _, sel := range selections {
+		for _, node := range sel.Nodes {
+			removeComments(node)
+			minifyNode(node)
+		}
+	}
+}
+
+func removeComments(node *html.Node) {
+	child := node.FirstChild
+	for child != nil {
+		next := child.NextSibling
+		if child.Type == html.CommentNode {
+			node.RemoveChild(child)
+		} else {
+			removeComments(child)
+		}
+		child = next
+	}
+	// text which a comment sat within is joined back together
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		for child.Type == html.TextNode && child.NextSibling != nil && child.NextSibling.Type == html.TextNode {
+			child.Data += child.NextSibling.Data
+			node.RemoveChild(child.NextSibling)
+		}
+	}
+}
+
+func minifyNode(node *html.Node) {
+	if node.Type == html.ElementNode {
+		if node.Data == "script" || node.Data == "style" {
+			keepLineBreaks(node, keptRawLineBreak)
+			return
+		}
+		if purse.SliceContains(GetPreformattedTags(), node.Data) {
+			keepLineBreaks(node, keptLineBreak)
+			return
+		}
+		if hasAttr(node, KeyElementMd) {
+			return
+		}
+	}
+	child := node.FirstChild
+	for child != nil {
+		next := child.NextSibling
+		if child.Type != html.TextNode {
+			minifyNode(child)
+			child = next
+			continue
+		}
+		text := whitespaceRe.ReplaceAllString(child.Data, " ")
+		if isBlockEdge(node, child.PrevSibling) {
+			text = strings.TrimLeft(text, " ")
+		}
+		if isBlockEdge(node, child.NextSibling) {
+			text = strings.TrimRight(text, " ")
+		}
+		if text == "" {
+			node.RemoveChild(child)
+		} else {
+			child.Data = text
+		}
+		child = next
+	}
+}
+
+// isBlockEdge reports whether whitespace next to sibling, a sibling of
+// text within parent, is never rendered.
+func isBlockEdge(parent *html.Node, sibling *html.Node) bool {
+	if sibling == nil {
+		return parent.Type == html.ElementNode && purse.SliceContains(GetBlockTags(), parent.Data)
+	}
+	return sibling.Type == html.ElementNode && purse.SliceContains(GetBlockTags(), sibling.Data)
+}
+
+// keepLineBreaks swaps the line breaks in the text of node for kept, so
+// they outlast the element being flattened.
+func keepLineBreaks(node *html.Node, kept string) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			child.Data = strings.ReplaceAll(child.Data, "\n", kept)
+			continue
+		}
+		keepLineBreaks(child, kept)
+	}
+}
+
+// RestoreLineBreaks writes the line breaks kept by MinifySelections back
+// into the markup of a component, as &#10; or, within a <script> or
+// <style>, as a "\n" joined onto the raw string the markup is written in.
+func RestoreLineBreaks(clay string) string {
+	clay = strings.ReplaceAll(clay, keptLineBreak, "&#10;")
+	return strings.ReplaceAll(clay, keptRawLineBreak, "` + \"\\n\" + `")
+}
+
+func hasAttr(node *html.Node, key string) bool {
+	for _, a := range node.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
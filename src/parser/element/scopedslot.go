@@ -0,0 +1,138 @@
+package element
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/phillip-england/purse"
+	"golang.org/x/net/html"
+)
+
+// scopedSlotRe matches a scoped slot rune, such as $slot("row", Guest),
+// with the item it is passed when that has been written already.
+var scopedSlotRe = regexp.MustCompile(`\$slot\(\s*["']([A-Za-z]+)["']\s*,\s*([^,()]+?)\s*(?:,\s*([^,()]+?)\s*)?\)`)
+
+// MarkSelectionsScopedSlots prepares the scoped slots of selections. A
+// scoped slot rune, such as $slot("row", Guest), is passed the item of
+// the _for over []Guest it sits in, and every _slot passing content to
+// it gets a _slot-type, so its content is written as a func of the item.
+func MarkSelectionsScopedSlots(selections []*goquery.Selection) error {
+	scoped := make(map[string]map[string]string)
+	for _, sel := range selections {
+		compName, exists := sel.Attr(KeyElementComponent)
+		if !exists {
+			continue
+		}
+		slots, err := markScopedSlotItems(sel)
+		if err != nil {
+			return err
+		}
+		if len(slots) > 0 {
+			scoped[compName] = slots
+		}
+	}
+	if len(scoped) == 0 {
+		return nil
+	}
+	for _, sel := range selections {
+		placeholders := sel.Find("[" + KeyElementPlaceholder + "]")
+		if _, exists := sel.Attr(KeyElementPlaceholder); exists {
+			placeholders = placeholders.AddSelection(sel)
+		}
+		placeholders.Each(func(i int, placeholder *goquery.Selection) {
+			name, _ := placeholder.Attr(KeyElementPlaceholder)
+			slots, ok := scoped[name]
+			if !ok {
+				return
+			}
+			placeholder.Children().Each(func(i int, child *goquery.Selection) {
+				slot, _ := child.Attr(KeyElementSlot)
+				if itemType, ok := slots[slot]; ok {
+					child.SetAttr(KeyElementSlotType, itemType)
+				}
+			})
+		})
+	}
+	return nil
+}
+
+// markScopedSlotItems fills in the item of each scoped slot rune in sel
+// from the _for it sits in, and returns the type of every scoped slot.
+func markScopedSlotItems(sel *goquery.Selection) (map[string]string, error) {
+	slots := make(map[string]string)
+	var walk func(node *html.Node) error
+	replace := func(node *html.Node, text string) (string, error) {
+		var potErr error
+		text = scopedSlotRe.ReplaceAllStringFunc(text, func(match string) string {
+			parts := scopedSlotRe.FindStringSubmatch(match)
+			name, itemType, item := parts[1], parts[2], parts[3]
+			slots[name] = itemType
+			if item != "" {
+				return match
+			}
+			item = findLoopItem(node, itemType)
+			if item == "" {
+				potErr = fmt.Errorf(purse.Fmt(`
+scoped slot found outside of a _for over []%s: %s
+a scoped $slot is passed the item of the _for it sits in, or the item may be written out as in $slot("%s", %s, item)`, itemType, match, name, itemType))
+				return match
+			}
+			return fmt.Sprintf(`$slot("%s", %s, %s)`, name, itemType, item)
+		})
+		return text, potErr
+	}
+	walk = func(node *html.Node) error {
+		switch node.Type {
+		case html.TextNode:
+			text, err := replace(node, node.Data)
+			if err != nil {
+				return err
+			}
+			node.Data = text
+		case html.ElementNode:
+			for i, a := range node.Attr {
+				val, err := replace(node, a.Val)
+				if err != nil {
+					return err
+				}
+				node.Attr[i].Val = val
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			err := walk(child)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, node := range sel.Nodes {
+		err := walk(node)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return slots, nil
+}
+
+// findLoopItem returns the item of the nearest _for over []itemType
+// around node, or an empty string when there is none.
+func findLoopItem(node *html.Node, itemType string) string {
+	for n := node; n != nil; n = n.Parent {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		for _, a := range n.Attr {
+			if a.Key != KeyElementFor {
+				continue
+			}
+			parts := strings.Fields(a.Val)
+			if len(parts) == 4 && parts[3] == "[]"+itemType {
+				return parts[0]
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package element
+
+import (
+	"fmt"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gqpp"
+	"github.com/phillip-england/gtml/src/parser/attr"
+	"github.com/phillip-england/purse"
+)
+
+// ElementSlotDefault is written by a component where a slot goes, as in
+// <nav _slot-default="sidebar">...</nav>. It is replaced by the slot when
+// one is passed, and is written itself when none is.
+type ElementSlotDefault struct {
+	Selection *goquery.Selection
+	Html      string
+	Type      string
+	Attr      string
+	AttrParts []string
+	Name      string
+	CompNames []string
+	Attrs     []attr.Attr
+}
+
+func NewSlotDefault(htmlStr string, sel *goquery.Selection, compNames []string) (*ElementSlotDefault, error) {
+	elm := &ElementSlotDefault{
+		CompNames: compNames,
+	}
+	err := fungi.Process(
+		func() error { return elm.initSelection(sel) },
+		func() error { return elm.initType() },
+		func() error { return elm.initHtml() },
+		func() error { return elm.initAttr() },
+		func() error { return elm.initAttrs() },
+		func() error { return elm.initName() },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return elm, nil
+}
+
+func (elm *ElementSlotDefault) GetSelection() *goquery.Selection { return elm.Selection }
+
+func (elm *ElementSlotDefault) GetHtml() string        { return elm.Html }
+func (elm *ElementSlotDefault) SetHtml(htmlStr string) { elm.Html = htmlStr }
+func (elm *ElementSlotDefault) Print()                 { fmt.Println(elm.Html) }
+func (elm *ElementSlotDefault) GetType() string        { return elm.Type }
+func (elm *ElementSlotDefault) GetAttr() string        { return elm.Attr }
+func (elm *ElementSlotDefault) GetAttrParts() []string { return elm.AttrParts }
+func (elm *ElementSlotDefault) GetName() string        { return elm.Name }
+func (elm *ElementSlotDefault) GetCompNames() []string { return elm.CompNames }
+func (elm *ElementSlotDefault) GetAttrs() []attr.Attr  { return elm.Attrs }
+func (elm *ElementSlotDefault) GetId() string {
+	salt, _ := elm.GetSelection().Attr("_id")
+	return salt
+}
+
+func (elm *ElementSlotDefault) initSelection(sel *goquery.Selection) error {
+	elm.Selection = sel
+	return nil
+}
+
+func (elm *ElementSlotDefault) initType() error {
+	elm.Type = KeyElementSlotDefault
+	return nil
+}
+
+func (elm *ElementSlotDefault) initHtml() error {
+	htmlStr, err := gqpp.NewHtmlFromSelection(elm.GetSelection())
+	if err != nil {
+		return err
+	}
+	elm.Html = htmlStr
+	return nil
+}
+
+func (elm *ElementSlotDefault) initAttr() error {
+	attr, err := gqpp.ForceElementAttr(elm.GetSelection(), KeyElementSlotDefault)
+	if err != nil {
+		return err
+	}
+	parts, err := gqpp.ForceElementAttrParts(elm.GetSelection(), KeyElementSlotDefault, 1)
+	if err != nil {
+		return err
+	}
+	elm.Attr = attr
+	elm.AttrParts = parts
+	return nil
+}
+
+func (elm *ElementSlotDefault) initAttrs() error {
+	for _, a := range elm.GetSelection().Get(0).Attr {
+		if purse.MustEqualOneOf(a.Key, GetChildElementList()...) {
+			continue
+		}
+		attr, err := attr.NewAttr(a.Key, a.Val)
+		if err != nil {
+			return err
+		}
+		elm.Attrs = append(elm.Attrs, attr)
+	}
+	return nil
+}
+
+func (elm *ElementSlotDefault) initName() error {
+	elm.Name = fmt.Sprintf("%s:%s", elm.GetType(), elm.GetAttr())
+	return nil
+}
@@ -0,0 +1,43 @@
+package gtmlfunc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/phillip-england/gtml/src/parser/gtmlvar"
+	"github.com/phillip-england/gtml/src/parser/param"
+)
+
+// GoCachedFunc is a component function restored from the build cache.
+// It carries the generated source and params but none of the parse state.
+type GoCachedFunc struct {
+	Name   string
+	Data   string
+	Params []param.Param
+}
+
+func NewGoCachedFunc(name string, data string, paramStrs []string) (*GoCachedFunc, error) {
+	fn := &GoCachedFunc{
+		Name: name,
+		Data: data,
+	}
+	for _, paramStr := range paramStrs {
+		parts := strings.SplitN(paramStr, " ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid cached param: %s", paramStr)
+		}
+		p, err := param.NewParam(parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+		fn.Params = append(fn.Params, p)
+	}
+	return fn, nil
+}
+
+func (fn *GoCachedFunc) GetName() string          { return fn.Name }
+func (fn *GoCachedFunc) GetData() string          { return fn.Data }
+func (fn *GoCachedFunc) SetData(str string)       { fn.Data = str }
+func (fn *GoCachedFunc) GetVars() []gtmlvar.Var   { return nil }
+func (fn *GoCachedFunc) GetParams() []param.Param { return fn.Params }
+func (fn *GoCachedFunc) Print()                   { fmt.Println(fn.GetData()) }
@@ -1,16 +1,24 @@
 package gtmlfunc
 
 import (
+	"bytes"
 	"fmt"
+	"go/ast"
 	"go/format"
-	"gtml/src/parser/call"
-	"gtml/src/parser/element"
-	"gtml/src/parser/gtmlvar"
-	"gtml/src/parser/param"
+	"go/parser"
+	"go/token"
+	"strconv"
 	"strings"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/phillip-england/fungi"
 	"github.com/phillip-england/gqpp"
+	"github.com/phillip-england/gtml/src/parser/attr"
+	"github.com/phillip-england/gtml/src/parser/call"
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/gtmlrune"
+	"github.com/phillip-england/gtml/src/parser/gtmlvar"
+	"github.com/phillip-england/gtml/src/parser/param"
 	"github.com/phillip-england/purse"
 )
 
@@ -26,7 +34,7 @@ type GoComponentFunc struct {
 	BuilderCalls            []string
 	ReturnCalls             []string
 	PlaceholderCalls        []call.Call
-	OrderedPlaceholderCalls []string
+	OrderedPlaceholderCalls [][]string
 }
 
 func NewGoComponentFunc(elm element.Element, siblings []element.Element) (*GoComponentFunc, error) {
@@ -35,6 +43,8 @@ func NewGoComponentFunc(elm element.Element, siblings []element.Element) (*GoCom
 	}
 	err := fungi.Process(
 		func() error { return fn.initName() },
+		func() error { return fn.initLets() },
+		func() error { return fn.initHead() },
 		func() error { return fn.initVars() },
 		func() error { return fn.initVarStr() },
 		func() error { return fn.initParams() },
@@ -46,6 +56,7 @@ func NewGoComponentFunc(elm element.Element, siblings []element.Element) (*GoCom
 		func() error { return fn.initOrderPlaceholderCalls(siblings) },
 		func() error { return fn.initWriteCorrectPlaceholderCalls() },
 		func() error { return fn.initFormatData() },
+		func() error { return fn.initAssets() },
 	)
 	if err != nil {
 		return nil, err
@@ -53,6 +64,7 @@ func NewGoComponentFunc(elm element.Element, siblings []element.Element) (*GoCom
 
 	return fn, nil
 }
+func (fn *GoComponentFunc) GetName() string          { return fn.Name }
 func (fn *GoComponentFunc) GetData() string          { return fn.Data }
 func (fn *GoComponentFunc) SetData(str string)       { fn.Data = str }
 func (fn *GoComponentFunc) GetVars() []gtmlvar.Var   { return fn.Vars }
@@ -68,6 +80,67 @@ func (fn *GoComponentFunc) initName() error {
 	return nil
 }
 
+// initLets makes sure _let is only used where a body is generated to
+// declare it in, and that its variables stay local to the component.
+func (fn *GoComponentFunc) initLets() error {
+	sel := fn.Element.GetSelection()
+	letNames := element.ReadLetNames(sel)
+	if len(letNames) == 0 {
+		return nil
+	}
+	var err error
+	sel.Find("[" + element.KeyElementLet + "]").EachWithBreak(func(i int, inner *goquery.Selection) bool {
+		if gqpp.HasAttr(inner, element.KeyElementFor, element.KeyElementComponent) {
+			return true
+		}
+		htmlStr, _ := goquery.OuterHtml(inner)
+		err = fmt.Errorf(purse.Fmt(`
+_let found on an element which is not a _component or _for element: %s
+_let variables are declared at the top of a _component or _for body`, htmlStr))
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	sel.Find("[" + element.KeyElementPlaceholder + "]").EachWithBreak(func(i int, inner *goquery.Selection) bool {
+		for _, attr := range inner.Nodes[0].Attr {
+			runes, _ := gtmlrune.NewRunesFromStr(fmt.Sprintf(`%s="%s"`, attr.Key, attr.Val))
+			for _, rn := range runes {
+				if rn.GetType() != gtmlrune.KeyRunePipe {
+					continue
+				}
+				if !purse.SliceContains(letNames, rn.GetValue()) {
+					continue
+				}
+				err = fmt.Errorf(purse.Fmt(`
+_let variable passed to a _placeholder with %s in _component %s
+_let variables are local to their component and can not be piped
+pass the values the variable is computed from instead`, rn.GetDecodedData(), fn.Name))
+				return false
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// initHead makes sure _head is only used on the elements a <head> may
+// hold.
+func (fn *GoComponentFunc) initHead() error {
+	var err error
+	fn.Element.GetSelection().Find("[" + element.KeyElementHead + "]").EachWithBreak(func(i int, inner *goquery.Selection) bool {
+		if purse.SliceContains(element.GetHeadTags(), goquery.NodeName(inner)) && !gqpp.HasAttr(inner, element.KeyElementComponent) {
+			return true
+		}
+		htmlStr, _ := goquery.OuterHtml(inner)
+		err = fmt.Errorf(purse.Fmt(`
+_head found on an element which does not belong in a <head>: %s
+_head may only be used on %s elements`, htmlStr, strings.Join(element.GetHeadTags(), ", ")))
+		return false
+	})
+	return err
+}
+
 func (fn *GoComponentFunc) initVars() error {
 	if fn.Element.GetType() == element.KeyElementPlaceholder {
 		goVar, err := gtmlvar.NewVar(fn.Element)
@@ -138,11 +211,14 @@ func (fn *GoComponentFunc) initData() error {
 	if fn.Element.GetType() == element.KeyElementPlaceholder {
 		returnCall = fmt.Sprintf("%s()", goVar.GetVarName())
 	}
+	if element.IsDocument(fn.Element) {
+		returnCall = fmt.Sprintf("gtmlDocument(%s)", returnCall)
+	}
 
 	data := purse.RemoveFirstLine(fmt.Sprintf(`
 func %s(%s) string {
 %s
-return gtmlEscape(%s)
+return %s
 }
 `, fn.Name, fn.ParamStr, series, returnCall))
 	data = purse.RemoveEmptyLines(data)
@@ -197,44 +273,55 @@ func (fn *GoComponentFunc) initPlaceholderCalls() error {
 }
 
 func (fn *GoComponentFunc) initOrderPlaceholderCalls(siblings []element.Element) error {
-	// Initialize an empty slice to hold the ordered placeholder call strings.
-	ordered := make([]string, 0)
+	// Initialize an empty slice to hold the ordered params for each placeholder call.
+	ordered := make([][]string, 0)
 
-	// Iterate through all sibling elements.
-	for _, sib := range siblings {
-		// Skip processing if the sibling element has the same name as the current element.
-		if fn.Element.GetName() == sib.GetName() {
-			continue
-		}
+	// Each call is ordered against the sibling _component it targets.
+	for _, call := range fn.PlaceholderCalls {
+		callStr := call.GetData()
+		callName := callStr[:strings.Index(callStr, "(")]
+		callOrdered := make([]string, 0)
 
-		// Retrieve parameters for the sibling element.
-		params, err := param.NewParamsFromElement(sib)
-		if err != nil {
-			return err // Return any error encountered during parameter retrieval.
-		}
+		for _, sib := range siblings {
+			// Skip processing if the sibling element has the same name as the current element.
+			if fn.Element.GetName() == sib.GetName() {
+				continue
+			}
+			// Skip siblings which are not the target of this call.
+			if element.GetComponentName(sib) != callName {
+				continue
+			}
 
-		// Initialize slices for unique sibling parameters and already processed parameter names.
-		sibParams := make([]param.Param, 0)
-		found := make([]string, 0)
+			// Retrieve parameters for the sibling element.
+			params, err := param.NewParamsFromElement(sib)
+			if err != nil {
+				return err // Return any error encountered during parameter retrieval.
+			}
 
-		// Filter out duplicate parameters from the sibling element.
-		for _, param := range params {
-			if purse.SliceContains(found, param.GetStr()) {
-				continue // Skip if the parameter has already been processed.
+			// Initialize slices for unique sibling parameters and already processed parameter names.
+			sibParams := make([]param.Param, 0)
+			found := make([]string, 0)
+
+			// Filter out duplicate parameters from the sibling element.
+			for _, param := range params {
+				if purse.SliceContains(found, param.GetStr()) {
+					continue // Skip if the parameter has already been processed.
+				}
+				sibParams = append(sibParams, param) // Add unique parameters.
+				found = append(found, param.GetStr())
 			}
-			sibParams = append(sibParams, param) // Add unique parameters.
-			found = append(found, param.GetStr())
-		}
 
-		// Iterate through each unique sibling parameter.
-		for _, sibParam := range sibParams {
-			// Loop through all placeholder calls in the current function.
-			for _, call := range fn.PlaceholderCalls {
-				// Retrieve parameters for the current placeholder call.
-				callParams := call.GetParams()
+			// Slots may be left out of the call, they are then empty.
+			slotNames, err := param.NewSlotNamesFromElement(sib)
+			if err != nil {
+				return err
+			}
 
+			// Iterate through each unique sibling parameter.
+			for _, sibParam := range sibParams {
+				matched := false
 				// Process each parameter in the call.
-				for _, callParam := range callParams {
+				for _, callParam := range call.GetParams() {
 					clay := callParam
 					// Clean up the parameter string by removing "ATTRID" substrings.
 					clay = strings.Replace(clay, "ATTRID", "", 1)
@@ -252,6 +339,9 @@ func (fn *GoComponentFunc) initOrderPlaceholderCalls(siblings []element.Element)
 						filtered = append(filtered, part)
 					}
 					callParamParts = filtered
+					if len(callParamParts) == 0 {
+						continue
+					}
 
 					// Extract the identifier (first part) of the cleaned parameter string.
 					callParamId := callParamParts[0]
@@ -269,11 +359,27 @@ func (fn *GoComponentFunc) initOrderPlaceholderCalls(siblings []element.Element)
 						if writeAs == "\"\\\\true\"" || writeAs == "\"\\\\false\"" {
 							writeAs = strings.ReplaceAll(writeAs, "\\", "")
 						}
-						ordered = append(ordered, writeAs)
+						if sibParamName == param.KeyParamAttrs {
+							rest, err := filterRestAttrs(writeAs, sibParams)
+							if err != nil {
+								return err
+							}
+							writeAs = rest
+						}
+						callOrdered = append(callOrdered, writeAs)
+						matched = true
 					}
 				}
+				if !matched && purse.SliceContains(slotNames, sibParam.GetName()) {
+					if sibParam.GetType() != "string" {
+						callOrdered = append(callOrdered, sibParam.GetType()+` { return "" }`)
+						continue
+					}
+					callOrdered = append(callOrdered, `""`)
+				}
 			}
 		}
+		ordered = append(ordered, callOrdered)
 	}
 
 	// Set the ordered placeholder calls for the function.
@@ -283,12 +389,63 @@ func (fn *GoComponentFunc) initOrderPlaceholderCalls(siblings []element.Element)
 	return nil
 }
 
+// filterRestAttrs drops the attributes from the map a placeholder passes
+// to a component with _rest which are props of that component, so only
+// the rest of them are spread.
+func filterRestAttrs(attrs string, params []param.Param) (string, error) {
+	expr, err := parser.ParseExpr(attrs)
+	if err != nil {
+		return "", err
+	}
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return attrs, nil
+	}
+	names := make([]string, 0)
+	for _, p := range params {
+		names = append(names, p.GetName())
+	}
+	kept := make([]ast.Expr, 0)
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.BasicLit)
+		if !ok {
+			continue
+		}
+		name, err := strconv.Unquote(key.Value)
+		if err != nil {
+			return "", err
+		}
+		a, err := attr.NewAttr(name, "")
+		if err != nil {
+			return "", err
+		}
+		if purse.SliceContains(names, a.GetKey()) {
+			continue
+		}
+		kept = append(kept, elt)
+	}
+	if len(kept) == 0 {
+		return "nil", nil
+	}
+	lit.Elts = kept
+	var buf bytes.Buffer
+	err = format.Node(&buf, token.NewFileSet(), lit)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
 func (fn *GoComponentFunc) initWriteCorrectPlaceholderCalls() error {
-	for _, call := range fn.PlaceholderCalls {
+	for callIndex, call := range fn.PlaceholderCalls {
 		callStr := call.GetData()
 		i := strings.Index(callStr, "(")
 		callName := callStr[:i]
-		paramStr := strings.Join(fn.OrderedPlaceholderCalls, ", ")
+		paramStr := strings.Join(fn.OrderedPlaceholderCalls[callIndex], ", ")
 		fnCall := fmt.Sprintf(`%s(%s)`, callName, paramStr)
 		fn.Data = strings.Replace(fn.Data, callStr, fnCall, 1)
 	}
@@ -322,3 +479,36 @@ func (fn *GoComponentFunc) initFormatData() error {
 	fn.Data = data
 	return nil
 }
+
+// initAssets writes the _scoped styles and _once scripts of the component
+// into consts after its func, which GtmlStyles and GtmlScripts join.
+func (fn *GoComponentFunc) initAssets() error {
+	styles := make([]string, 0)
+	scripts := make([]string, 0)
+	element.ReadAssetSelections(fn.Element.GetSelection()).Each(func(i int, sel *goquery.Selection) {
+		text := element.ReadAsset(sel)
+		if text == "" {
+			return
+		}
+		if goquery.NodeName(sel) == "style" {
+			styles = append(styles, text)
+			return
+		}
+		scripts = append(scripts, text)
+	})
+	if len(styles) > 0 {
+		fn.Data += fmt.Sprintf("\nconst %s = %s\n", GetStyleConstName(fn.Name), strconv.Quote(strings.Join(styles, "\n")+"\n"))
+	}
+	if len(scripts) > 0 {
+		fn.Data += fmt.Sprintf("\nconst %s = %s\n", GetScriptConstName(fn.Name), strconv.Quote(strings.Join(scripts, "\n")+"\n"))
+	}
+	return nil
+}
+
+// GetStyleConstName returns the const holding the _scoped styles of the
+// _component named name.
+func GetStyleConstName(name string) string { return "gtml" + name + "Style" }
+
+// GetScriptConstName returns the const holding the _once scripts of the
+// _component named name.
+func GetScriptConstName(name string) string { return "gtml" + name + "Script" }
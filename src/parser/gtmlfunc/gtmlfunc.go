@@ -2,12 +2,14 @@ package gtmlfunc
 
 import (
 	"fmt"
-	"gtml/src/parser/element"
-	"gtml/src/parser/gtmlvar"
-	"gtml/src/parser/param"
+
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/gtmlvar"
+	"github.com/phillip-england/gtml/src/parser/param"
 )
 
 type Func interface {
+	GetName() string
 	GetData() string
 	SetData(str string)
 	GetVars() []gtmlvar.Var
@@ -0,0 +1,72 @@
+package gtmlrune
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/funcarg"
+	"github.com/phillip-england/purse"
+)
+
+// Ctx reads a value from the context.Context of the component, so data
+// like the current user reaches deep components without a $pipe chain.
+type Ctx struct {
+	Data        string
+	DecodedData string
+	Value       string
+	Type        string
+	Location    string
+	Args        []funcarg.FuncArg
+}
+
+func NewCtx(data string) (*Ctx, error) {
+	r := &Ctx{
+		DecodedData: data,
+		Data:        html.UnescapeString(data),
+		Type:        KeyRuneCtx,
+	}
+	err := fungi.Process(
+		func() error { return r.initValue() },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Ctx) Print()                     { fmt.Println(r.Data) }
+func (r *Ctx) GetValue() string           { return r.Value }
+func (r *Ctx) GetType() string            { return r.Type }
+func (r *Ctx) GetDecodedData() string     { return r.DecodedData }
+func (r *Ctx) GetLocation() string        { return r.Location }
+func (r *Ctx) GetArgs() []funcarg.FuncArg { return r.Args }
+
+func (r *Ctx) initValue() error {
+	errMsg := purse.Fmt(`
+invalid $ctx rune found: %s
+$ctx must contain a single key wrapped in quotes such as $ctx("user")
+$ctx keys may only contain letters, numbers, '_', '-' and '.'`, r.Data)
+	index := strings.Index(r.Data, "(") + 1
+	part := r.Data[index:]
+	if !strings.HasSuffix(part, ")") {
+		return fmt.Errorf(errMsg)
+	}
+	val := purse.Squeeze(part[:len(part)-1])
+	if len(val) < 3 {
+		return fmt.Errorf(errMsg)
+	}
+	quote := val[:1]
+	if (quote != "\"" && quote != "'") || !strings.HasSuffix(val, quote) {
+		return fmt.Errorf(errMsg)
+	}
+	val = val[1 : len(val)-1]
+	whitelist := purse.GetAllLetters()
+	whitelist = append(whitelist, strings.Split("0123456789_-.", "")...)
+	if !purse.EnforeWhitelist(val, whitelist) {
+		return fmt.Errorf(errMsg)
+	}
+	r.Value = val
+	return nil
+}
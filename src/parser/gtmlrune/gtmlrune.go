@@ -1,10 +1,10 @@
 package gtmlrune
 
 import (
-	"gtml/src/parser/element"
-	"gtml/src/parser/funcarg"
 	"strings"
 
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/funcarg"
 	"github.com/phillip-england/purse"
 )
 
@@ -46,6 +46,13 @@ func NewGtmlRune(runeStr string, location string) (GtmlRune, error) {
 		}
 		return r, nil
 	}
+	if strings.HasPrefix(runeStr, KeyRuneCtx) {
+		r, err := NewCtx(runeStr)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
 	return nil, nil
 }
 
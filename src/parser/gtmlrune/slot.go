@@ -2,11 +2,12 @@ package gtmlrune
 
 import (
 	"fmt"
-	"gtml/src/parser/funcarg"
 	"html"
 	"strings"
 
 	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/funcarg"
 	"github.com/phillip-england/purse"
 )
 
@@ -51,6 +52,26 @@ invalid $prop rune found: %s`, r.Data)
 		return fmt.Errorf(msg)
 	}
 	val := part[:len(part)-1]
+	// a scoped slot names the type of its item and, once gtml has found
+	// the _for it sits in, the item itself
+	if strings.Contains(val, ",") {
+		parts := strings.Split(val, ",")
+		val = strings.TrimSpace(parts[0])
+		for _, p := range parts[1:] {
+			arg, err := funcarg.NewFuncArg(strings.TrimSpace(p))
+			if err != nil || arg.GetType() != funcarg.KeyFuncArgRaw {
+				return fmt.Errorf(purse.Fmt(`
+invalid $slot rune found: %s
+a scoped $slot names the type of its item, such as $slot("row", Guest)`, r.Data))
+			}
+			r.Args = append(r.Args, arg)
+		}
+		if len(r.Args) > 2 {
+			return fmt.Errorf(purse.Fmt(`
+invalid $slot rune found: %s
+a scoped $slot names the type of its item, such as $slot("row", Guest)`, r.Data))
+		}
+	}
 
 	valFirstChar := string(val[0])
 	valLastChar := string(val[len(val)-1])
@@ -114,3 +135,24 @@ $slot may only contain characters; no symbols, numbers, or spaces
 	r.Value = purse.Squeeze(val)
 	return nil
 }
+
+// IsScoped reports if the slot is passed the item of a _for, as in
+// $slot("row", Guest).
+func (r *Slot) IsScoped() bool { return len(r.Args) > 0 }
+
+// GetParamType returns the type the slot is passed to its component as.
+func (r *Slot) GetParamType() string {
+	if !r.IsScoped() {
+		return "string"
+	}
+	return fmt.Sprintf("func(%s %s) string", element.KeySlotItem, r.Args[0].GetValue())
+}
+
+// GetCall returns what writes the slot. A scoped slot is called with its
+// item, which gtml fills in from the _for the rune sits in.
+func (r *Slot) GetCall() string {
+	if len(r.Args) < 2 {
+		return r.Value
+	}
+	return fmt.Sprintf("%s(%s)", r.Value, r.Args[1].GetValue())
+}
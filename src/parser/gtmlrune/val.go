@@ -2,11 +2,11 @@ package gtmlrune
 
 import (
 	"fmt"
-	"gtml/src/parser/funcarg"
 	"html"
 	"strings"
 
 	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/funcarg"
 	"github.com/phillip-england/purse"
 )
 
@@ -0,0 +1,24 @@
+package gtmlvar
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/phillip-england/gtml/src/parser/element"
+)
+
+// dropAssets removes the _scoped styles and _once scripts from clay, as
+// they are written into the style and script bundles instead.
+func dropAssets(elm element.Element, clay string) (string, error) {
+	var err error
+	element.ReadAssetSelections(elm.GetSelection()).EachWithBreak(func(i int, sel *goquery.Selection) bool {
+		var asset string
+		asset, err = goquery.OuterHtml(sel)
+		if err != nil {
+			return false
+		}
+		clay = strings.Replace(clay, asset, "", 1)
+		return true
+	})
+	return clay, err
+}
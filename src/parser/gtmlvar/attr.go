@@ -0,0 +1,184 @@
+package gtmlvar
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/param"
+	"github.com/phillip-england/purse"
+	xhtml "golang.org/x/net/html"
+)
+
+// writeAttrDirectives swaps the start tags in clay which hold _attr:,
+// _class or _rest for ones writing those attributes through gtmlAttr,
+// gtmlClass and gtmlRest. The start tags are rendered the same way clay
+// was, so they are found as they were written.
+func writeAttrDirectives(elm element.Element, clay string, builderName string) (string, error) {
+	for _, sel := range element.ReadAttrDirectiveSelections(elm.GetSelection()) {
+		node := sel.Nodes[0]
+		attrs, err := element.ReadCondAttrs(sel)
+		if err != nil {
+			return "", err
+		}
+		classes, err := element.ReadCondClasses(sel)
+		if err != nil {
+			return "", err
+		}
+		_, hasClasses := sel.Attr(element.KeyElementClass)
+		_, hasRest := sel.Attr(element.KeyElementRest)
+		mergeClass := hasClasses || hasRest
+		controlled := make([]string, 0)
+		for _, attr := range attrs {
+			controlled = append(controlled, attr.Name)
+		}
+		kept := make([]xhtml.Attribute, 0)
+		values := make(map[string]string)
+		staticClass := ""
+		fragment := element.IsFragment(sel)
+		for _, a := range node.Attr {
+			switch {
+			case fragment && element.IsFragmentMarker(a.Key):
+			case a.Key == element.KeyElementSlotType:
+			case a.Key == element.KeyElementClass || a.Key == element.KeyElementRest || strings.HasPrefix(a.Key, element.KeyElementAttr):
+			case mergeClass && a.Key == "class":
+				staticClass = a.Val
+			case purse.SliceContains(controlled, a.Key):
+				values[a.Key] = a.Val
+			default:
+				kept = append(kept, a)
+			}
+		}
+		calls := ""
+		for _, attr := range attrs {
+			text := " " + attr.Name
+			value, hasValue := values[attr.Name]
+			if hasValue {
+				if strings.Contains(value, "$") {
+					return "", fmt.Errorf(purse.Fmt(`
+%s="%s" found, but runes can not be used in the value of an attribute written by %s%s`, attr.Name, value, element.KeyElementAttr, attr.Name))
+				}
+				text += `="` + html.EscapeString(value) + `"`
+			}
+			calls += fmt.Sprintf("%s.WriteString(gtmlAttr(%s, %s))", builderName, attr.Cond, strconv.Quote(text))
+		}
+		if mergeClass {
+			if strings.Contains(staticClass, "$") {
+				return "", fmt.Errorf(purse.Fmt(`
+class="%s" found alongside _class or _rest, but runes can not be used in a class which is merged with others`, staticClass))
+			}
+			args := []string{strconv.Quote(staticClass)}
+			for _, class := range classes {
+				args = append(args, fmt.Sprintf("gtmlAttr(%s, %s)", class.Cond, strconv.Quote(class.Name)))
+			}
+			if hasRest {
+				args = append(args, fmt.Sprintf("%s[\"class\"]", param.KeyParamAttrs))
+			}
+			calls += fmt.Sprintf("%s.WriteString(gtmlClass(%s))", builderName, strings.Join(args, ", "))
+		}
+		if hasRest {
+			// the attributes of the element itself win over passed ones
+			args := []string{param.KeyParamAttrs}
+			for _, a := range kept {
+				if !strings.HasPrefix(a.Key, "_") {
+					args = append(args, strconv.Quote(a.Key))
+				}
+			}
+			for _, name := range controlled {
+				args = append(args, strconv.Quote(name))
+			}
+			calls += fmt.Sprintf("%s.WriteString(gtmlRest(%s))", builderName, strings.Join(args, ", "))
+		}
+		oldTag, oldEnd, err := renderStartTag(node, node.Attr)
+		if err != nil {
+			return "", err
+		}
+		newTag, newEnd, err := renderStartTag(node, kept)
+		if err != nil {
+			return "", err
+		}
+		clay = strings.ReplaceAll(clay, oldTag+oldEnd, newTag+calls+newEnd)
+	}
+	return clay, nil
+}
+
+// dropFragmentMarkers removes the attributes gtml set on the root of a
+// fragment from its start tag in clay, so it is written as it is within
+// the _component the fragment was made from.
+func dropFragmentMarkers(elm element.Element, clay string) (string, error) {
+	sel := elm.GetSelection()
+	if !element.IsFragment(sel) {
+		return clay, nil
+	}
+	node := sel.Nodes[0]
+	kept := make([]xhtml.Attribute, 0, len(node.Attr))
+	for _, a := range node.Attr {
+		if !element.IsFragmentMarker(a.Key) {
+			kept = append(kept, a)
+		}
+	}
+	oldTag, oldEnd, err := renderStartTag(node, node.Attr)
+	if err != nil {
+		return "", err
+	}
+	newTag, newEnd, err := renderStartTag(node, kept)
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(clay, oldTag+oldEnd, newTag+newEnd, 1), nil
+}
+
+// dropSlotType removes the _slot-type gtml set on a _slot passed to a
+// scoped slot from its start tag in clay, so it is only read while
+// building and never rendered.
+func dropSlotType(elm element.Element, clay string) (string, error) {
+	sel := elm.GetSelection()
+	if _, scoped := sel.Attr(element.KeyElementSlotType); !scoped {
+		return clay, nil
+	}
+	node := sel.Nodes[0]
+	kept := make([]xhtml.Attribute, 0, len(node.Attr))
+	for _, a := range node.Attr {
+		if a.Key != element.KeyElementSlotType {
+			kept = append(kept, a)
+		}
+	}
+	oldTag, oldEnd, err := renderStartTag(node, node.Attr)
+	if err != nil {
+		return "", err
+	}
+	newTag, newEnd, err := renderStartTag(node, kept)
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(clay, oldTag+oldEnd, newTag+newEnd, 1), nil
+}
+
+// renderStartTag renders the start tag of node with attrs, split before
+// the > or /> closing it.
+func renderStartTag(node *xhtml.Node, attrs []xhtml.Attribute) (string, string, error) {
+	shallow := &xhtml.Node{
+		Type:      xhtml.ElementNode,
+		Data:      node.Data,
+		DataAtom:  node.DataAtom,
+		Namespace: node.Namespace,
+		Attr:      attrs,
+	}
+	var buf bytes.Buffer
+	err := xhtml.Render(&buf, shallow)
+	if err != nil {
+		return "", "", err
+	}
+	rendered := buf.String()
+	end := strings.Index(rendered, ">")
+	if end == -1 {
+		return "", "", fmt.Errorf("unable to render the start tag of: %s", node.Data)
+	}
+	if end > 0 && rendered[end-1] == '/' {
+		return rendered[:end-1], "/>", nil
+	}
+	return rendered[:end], ">", nil
+}
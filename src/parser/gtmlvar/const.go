@@ -6,9 +6,10 @@ const (
 	KeyVarGoElse        = "VARGOELSE"
 	KeyVarGoPlaceholder = "VARGOPLACEHOLDER"
 	KeyVarGoSlot        = "VARGOSLOT"
+	KeyVarGoSlotDefault = "VARGOSLOTDEFAULT"
 	KeyVarGoMd          = "VARGOMD"
 )
 
 func GetFullVarList() []string {
-	return []string{KeyVarGoFor, KeyVarGoIf, KeyVarGoElse, KeyVarGoPlaceholder, KeyVarGoSlot, KeyVarGoMd}
+	return []string{KeyVarGoFor, KeyVarGoIf, KeyVarGoElse, KeyVarGoPlaceholder, KeyVarGoSlot, KeyVarGoSlotDefault, KeyVarGoMd}
 }
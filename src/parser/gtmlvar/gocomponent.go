@@ -2,10 +2,10 @@ package gtmlvar
 
 import (
 	"fmt"
-	"gtml/src/parser/element"
 	"strings"
 
 	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/element"
 	"github.com/phillip-england/purse"
 )
 
@@ -14,6 +14,7 @@ type GoComponent struct {
 	VarName       string
 	BuilderName   string
 	Vars          []Var
+	LetDecls      string
 	WriteVarsAs   string
 	Data          string
 	BuilderSeries string
@@ -27,6 +28,7 @@ func NewGoComponent(elm element.Element) (*GoComponent, error) {
 	err := fungi.Process(
 		func() error { return v.initBasicInfo() },
 		func() error { return v.initVars() },
+		func() error { return v.initLetDecls() },
 		func() error { return v.initWriteVarsAs() },
 		func() error { return v.initBuilderSeries() },
 		func() error { return v.initData() },
@@ -61,6 +63,15 @@ func (v *GoComponent) initVars() error {
 	return nil
 }
 
+func (v *GoComponent) initLetDecls() error {
+	decls, err := GetLetDecls(v.Element)
+	if err != nil {
+		return err
+	}
+	v.LetDecls = decls
+	return nil
+}
+
 func (v *GoComponent) initWriteVarsAs() error {
 	varsToWrite := ""
 	for _, inner := range v.Vars {
@@ -82,11 +93,11 @@ func (v *GoComponent) initBuilderSeries() error {
 func (v *GoComponent) initData() error {
 	v.Data = purse.RemoveFirstLine(fmt.Sprintf(`
 %s := func() string {
-var %s strings.Builder
+%svar %s strings.Builder
 %s
 %s
 return %s.String()
-}`+"\n", v.VarName, v.BuilderName, v.WriteVarsAs, v.BuilderSeries, v.BuilderName))
+}`+"\n", v.VarName, v.LetDecls, v.BuilderName, v.WriteVarsAs, v.BuilderSeries, v.BuilderName))
 	// v.Data = purse.RemoveEmptyLines(v.Data)
 	return nil
 }
@@ -2,9 +2,9 @@ package gtmlvar
 
 import (
 	"fmt"
-	"gtml/src/parser/element"
 
 	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/element"
 	"github.com/phillip-england/purse"
 )
 
@@ -13,6 +13,7 @@ type GoFor struct {
 	VarName       string
 	BuilderName   string
 	Vars          []Var
+	LetDecls      string
 	WriteVarsAs   string
 	Data          string
 	IterItems     string
@@ -29,6 +30,7 @@ func NewGoFor(elm element.Element) (*GoFor, error) {
 	err := fungi.Process(
 		func() error { return v.initBasicInfo() },
 		func() error { return v.initVars() },
+		func() error { return v.initLetDecls() },
 		func() error { return v.initWriteVarsAs() },
 		func() error { return v.initBuilderSeries() },
 		func() error { return v.initData() },
@@ -71,6 +73,15 @@ func (v *GoFor) initVars() error {
 	return nil
 }
 
+func (v *GoFor) initLetDecls() error {
+	decls, err := GetLetDecls(v.Element)
+	if err != nil {
+		return err
+	}
+	v.LetDecls = decls
+	return nil
+}
+
 func (v *GoFor) initWriteVarsAs() error {
 	varsToWrite := ""
 	for _, inner := range v.Vars {
@@ -92,11 +103,11 @@ func (v *GoFor) initBuilderSeries() error {
 func (v *GoFor) initData() error {
 	v.Data = purse.RemoveFirstLine(fmt.Sprintf(`
 %s := gtmlFor(%s, func(i int, %s %s) string {
-var %s strings.Builder
+%svar %s strings.Builder
 %s
 %s
 return %s.String()
-})`+"\n", v.VarName, v.IterItems, v.IterItem, v.IterType, v.BuilderName, v.WriteVarsAs, v.BuilderSeries, v.BuilderName))
+})`+"\n", v.VarName, v.IterItems, v.IterItem, v.IterType, v.LetDecls, v.BuilderName, v.WriteVarsAs, v.BuilderSeries, v.BuilderName))
 	// v.Data = purse.RemoveEmptyLines(v.Data)
 	return nil
 }
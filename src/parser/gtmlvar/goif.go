@@ -2,9 +2,9 @@ package gtmlvar
 
 import (
 	"fmt"
-	"gtml/src/parser/element"
 
 	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/element"
 	"github.com/phillip-england/purse"
 )
 
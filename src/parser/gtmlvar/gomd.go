@@ -2,10 +2,10 @@ package gtmlvar
 
 import (
 	"fmt"
-	"gtml/src/parser/element"
 	"strings"
 
 	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/element"
 	"github.com/phillip-england/purse"
 )
 
@@ -59,10 +59,8 @@ func (v *GoMd) initBasicInfo() error {
 	v.BuilderName = attr + "Builder"
 	v.MdFilePath = v.Element.GetAttr()
 	sel := v.Element.GetSelection()
-	theme, exists := sel.Attr("_md-theme")
-	if !exists {
-		theme = "dracula"
-	}
+	// without _md-theme the theme of the build target is used
+	theme, _ := sel.Attr("_md-theme")
 	v.MdTheme = theme
 	v.Type = KeyVarGoMd
 	return nil
@@ -2,11 +2,14 @@ package gtmlvar
 
 import (
 	"fmt"
-	"gtml/src/parser/attr"
-	"gtml/src/parser/element"
+	"strconv"
 	"strings"
 
 	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/attr"
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/gtmlrune"
+	"github.com/phillip-england/gtml/src/parser/param"
 	"github.com/phillip-england/purse"
 )
 
@@ -103,9 +106,17 @@ func (v *GoPlaceholder) initBuilderSeries() error {
 }
 
 func (v *GoPlaceholder) initCallParams() error {
+	if _, exists := v.Element.GetSelection().Attr(element.KeyElementCtx); exists {
+		v.CallParams = append(v.CallParams, "ATTRID"+param.KeyParamCtx+"ATTRID"+param.KeyParamCtx)
+	}
 	for _, attr := range v.Attrs {
 		v.CallParams = append(v.CallParams, "ATTRID"+attr.GetKey()+"ATTRID\""+attr.GetValue()+"\"")
 	}
+	attrs, err := v.getAttrsMap()
+	if err != nil {
+		return err
+	}
+	v.CallParams = append(v.CallParams, "ATTRID"+param.KeyParamAttrs+"ATTRID"+attrs)
 	vars, err := NewVarsFromElement(v.Element)
 	if err != nil {
 		return err
@@ -129,6 +140,37 @@ func (v *GoPlaceholder) initCallParams() error {
 	return nil
 }
 
+// getAttrsMap writes every attribute of the placeholder as they were
+// written, for a component spreading them with _rest. The call is later
+// ordered against the component, which drops the map when it has no
+// _rest and drops the attributes which are its props from it.
+func (v *GoPlaceholder) getAttrsMap() (string, error) {
+	entries := make([]string, 0)
+	for _, a := range v.Element.GetSelection().Get(0).Attr {
+		if strings.HasPrefix(a.Key, "_") {
+			continue
+		}
+		value := strconv.Quote(a.Val)
+		runes, err := gtmlrune.NewRunesFromStr(fmt.Sprintf(`%s="%s"`, a.Key, a.Val))
+		if err != nil {
+			return "", err
+		}
+		// a value which is a single rune passes what the rune reads
+		if len(runes) == 1 && strings.TrimSpace(a.Val) == runes[0].GetDecodedData() {
+			switch runes[0].GetType() {
+			case gtmlrune.KeyRuneProp, gtmlrune.KeyRunePipe, gtmlrune.KeyRuneVal:
+				value = runes[0].GetValue()
+			}
+		}
+		// the call is split on spaces later, so the map is written without any
+		entries = append(entries, strconv.Quote(a.Key)+":"+value)
+	}
+	if len(entries) == 0 {
+		return "nil", nil
+	}
+	return param.KeyParamAttrsType + "{" + strings.Join(entries, ",") + "}", nil
+}
+
 func (v *GoPlaceholder) initData() error {
 	v.Data = purse.RemoveFirstLine(fmt.Sprintf(`
 %s := func() string {
@@ -2,9 +2,10 @@ package gtmlvar
 
 import (
 	"fmt"
-	"gtml/src/parser/element"
+	"strings"
 
 	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/element"
 	"github.com/phillip-england/purse"
 )
 
@@ -76,11 +77,41 @@ func (v *GoSlot) initBuilderSeries() error {
 	if err != nil {
 		return err
 	}
+	if _, implicit := v.Element.GetSelection().Attr(element.KeyElementSlotImplicit); implicit {
+		series, err = unwrapSeries(v.Element, v.BuilderName, series)
+		if err != nil {
+			return err
+		}
+	}
 	v.BuilderSeries = series
 	return nil
 }
 
+// unwrapSeries drops the start and end tag of elm from series, for the
+// element gtml wraps the loose children of a placeholder in.
+func unwrapSeries(elm element.Element, builderName string, series string) (string, error) {
+	node := elm.GetSelection().Get(0)
+	startTag, startEnd, err := renderStartTag(node, node.Attr)
+	if err != nil {
+		return "", err
+	}
+	series = strings.Replace(series, startTag+startEnd, "", 1)
+	series = purse.ReplaceLastInstanceOf(series, "</"+node.Data+">", "")
+	return strings.ReplaceAll(series, builderName+".WriteString(``)\n", ""), nil
+}
+
 func (v *GoSlot) initData() error {
+	// the content of a scoped slot is a func of the item it is passed
+	if itemType, scoped := v.Element.GetSelection().Attr(element.KeyElementSlotType); scoped {
+		v.Data = purse.RemoveFirstLine(fmt.Sprintf(`
+%s := func(%s %s) string {
+var %s strings.Builder
+%s
+%s
+return %s.String()
+}`+"\n", v.VarName, element.KeySlotItem, itemType, v.BuilderName, v.WriteVarsAs, v.BuilderSeries, v.BuilderName))
+		return nil
+	}
 	v.Data = purse.RemoveFirstLine(fmt.Sprintf(`
 %s := gtmlSlot(func() string {
 var %s strings.Builder
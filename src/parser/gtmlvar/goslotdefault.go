@@ -0,0 +1,97 @@
+package gtmlvar
+
+import (
+	"fmt"
+
+	"github.com/phillip-england/fungi"
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/purse"
+)
+
+// GoSlotDefault writes the slot named by a _slot-default element, or the
+// element itself when the slot is empty.
+type GoSlotDefault struct {
+	Element       element.Element
+	VarName       string
+	BuilderName   string
+	Vars          []Var
+	WriteVarsAs   string
+	Data          string
+	BuilderSeries string
+	BoolToCheck   string
+	Type          string
+}
+
+func NewGoSlotDefault(elm element.Element) (*GoSlotDefault, error) {
+	v := &GoSlotDefault{
+		Element: elm,
+	}
+	err := fungi.Process(
+		func() error { return v.initBasicInfo() },
+		func() error { return v.initVars() },
+		func() error { return v.initWriteVarsAs() },
+		func() error { return v.initBuilderSeries() },
+		func() error { return v.initData() },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (v *GoSlotDefault) GetData() string             { return v.Data }
+func (v *GoSlotDefault) GetVarName() string          { return v.VarName }
+func (v *GoSlotDefault) GetBuilderName() string      { return v.BuilderName }
+func (v *GoSlotDefault) GetType() string             { return v.Type }
+func (v *GoSlotDefault) GetElement() element.Element { return v.Element }
+func (v *GoSlotDefault) Print()                      { fmt.Print(v.Data) }
+
+func (v *GoSlotDefault) initBasicInfo() error {
+	attr := v.Element.GetAttr()
+	v.VarName = attr + "Default" + v.Element.GetId()
+	v.BuilderName = attr + "Builder"
+	v.BoolToCheck = attr
+	v.Type = KeyVarGoSlotDefault
+	return nil
+}
+
+func (v *GoSlotDefault) initVars() error {
+	vars, err := NewVarsFromElement(v.Element)
+	if err != nil {
+		return err
+	}
+	v.Vars = vars
+	return nil
+}
+
+func (v *GoSlotDefault) initWriteVarsAs() error {
+	varsToWrite := ""
+	for _, inner := range v.Vars {
+		varsToWrite += inner.GetData()
+	}
+	v.WriteVarsAs = varsToWrite
+	return nil
+}
+
+func (v *GoSlotDefault) initBuilderSeries() error {
+	series, err := GetElementAsBuilderSeries(v.Element, v.BuilderName)
+	if err != nil {
+		return err
+	}
+	v.BuilderSeries = series
+	return nil
+}
+
+func (v *GoSlotDefault) initData() error {
+	v.Data = purse.RemoveFirstLine(fmt.Sprintf(`
+%s := gtmlSlot(func() string {
+if %s != "" {
+return %s
+}
+var %s strings.Builder
+%s
+%s
+return %s.String()
+})`+"\n", v.VarName, v.BoolToCheck, v.BoolToCheck, v.BuilderName, v.WriteVarsAs, v.BuilderSeries, v.BuilderName))
+	return nil
+}
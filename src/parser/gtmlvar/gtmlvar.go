@@ -2,10 +2,12 @@ package gtmlvar
 
 import (
 	"fmt"
-	"gtml/src/parser/element"
-	"gtml/src/parser/gtmlrune"
+	"strconv"
 	"strings"
 
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/gtmlrune"
+	"github.com/phillip-england/gtml/src/parser/param"
 	"github.com/phillip-england/purse"
 )
 
@@ -62,6 +64,12 @@ func NewVar(elm element.Element) (Var, error) {
 			return nil, err
 		}
 		return v, nil
+	case element.KeyElementSlotDefault:
+		v, err := NewGoSlotDefault(elm)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
 
 	}
 
@@ -84,6 +92,21 @@ func NewVarsFromElement(elm element.Element) ([]Var, error) {
 	return vars, nil
 }
 
+// GetLetDecls declares the _let variables of elm as Go variables, to be
+// written at the top of the body elm generates.
+func GetLetDecls(elm element.Element) (string, error) {
+	lets, err := element.ReadLets(elm.GetSelection())
+	if err != nil {
+		return "", err
+	}
+	decls := ""
+	for _, let := range lets {
+		// a _let which nothing reads would otherwise fail to compile
+		decls += fmt.Sprintf("%s := %s\n_ = %s\n", let.Name, let.Expr, let.Name)
+	}
+	return decls, nil
+}
+
 func GetElementAsBuilderSeries(elm element.Element, builderName string) (string, error) {
 	clay := elm.GetHtml()
 	err := element.WalkElementDirectChildren(elm, func(child element.Element) error {
@@ -93,7 +116,7 @@ func GetElementAsBuilderSeries(elm element.Element, builderName string) (string,
 			return err
 		}
 		varType := newVar.GetType()
-		if purse.MustEqualOneOf(varType, KeyVarGoElse, KeyVarGoFor, KeyVarGoIf, KeyVarGoPlaceholder, KeyVarGoMd, KeyVarGoSlot) {
+		if purse.MustEqualOneOf(varType, KeyVarGoElse, KeyVarGoFor, KeyVarGoIf, KeyVarGoPlaceholder, KeyVarGoMd, KeyVarGoSlot, KeyVarGoSlotDefault) {
 			if varType == KeyVarGoPlaceholder {
 				call := fmt.Sprintf("%s.WriteString(%s())", builderName, newVar.GetVarName())
 				clay = strings.Replace(clay, childHtml, call, 1)
@@ -106,28 +129,49 @@ func GetElementAsBuilderSeries(elm element.Element, builderName string) (string,
 	if err != nil {
 		return "", err
 	}
+	clay, err = writeAttrDirectives(elm, clay, builderName)
+	if err != nil {
+		return "", err
+	}
+	clay, err = dropFragmentMarkers(elm, clay)
+	if err != nil {
+		return "", err
+	}
+	clay, err = dropSlotType(elm, clay)
+	if err != nil {
+		return "", err
+	}
+	clay, err = dropAssets(elm, clay)
+	if err != nil {
+		return "", err
+	}
 	runes, err := gtmlrune.NewRunesFromElement(elm)
 	if err != nil {
 		return "", err
 	}
 	for _, rn := range runes {
 		if rn.GetType() == gtmlrune.KeyRuneProp {
-			call := fmt.Sprintf("%s.WriteString(%s)", builderName, rn.GetValue())
+			call := fmt.Sprintf("%s.WriteString(gtmlEscape(%s))", builderName, rn.GetValue())
 			clay = strings.Replace(clay, rn.GetDecodedData(), call, 1)
 		}
 		if rn.GetType() == gtmlrune.KeyRuneVal {
-			call := fmt.Sprintf("%s.WriteString(%s)", builderName, rn.GetValue())
+			call := fmt.Sprintf("%s.WriteString(gtmlEscape(%s))", builderName, rn.GetValue())
 			clay = strings.Replace(clay, rn.GetDecodedData(), call, 1)
 		}
 		if rn.GetType() == gtmlrune.KeyRunePipe {
-			call := fmt.Sprintf("%s.WriteString(%s)", builderName, rn.GetValue())
+			call := fmt.Sprintf("%s.WriteString(gtmlEscape(%s))", builderName, rn.GetValue())
+			clay = strings.Replace(clay, rn.GetDecodedData(), call, 1)
+		}
+		if rn.GetType() == gtmlrune.KeyRuneCtx {
+			call := fmt.Sprintf("%s.WriteString(gtmlEscape(gtmlCtx(%s, %s)))", builderName, param.KeyParamCtx, strconv.Quote(rn.GetValue()))
 			clay = strings.Replace(clay, rn.GetDecodedData(), call, 1)
 		}
-		if rn.GetType() == gtmlrune.KeyRuneSlot {
-			call := fmt.Sprintf("%s.WriteString(%s)", builderName, rn.GetValue())
+		if slot, ok := rn.(*gtmlrune.Slot); ok {
+			call := fmt.Sprintf("%s.WriteString(%s)", builderName, slot.GetCall())
 			clay = strings.Replace(clay, rn.GetDecodedData(), call, 1)
 		}
 	}
+	clay = element.RestoreLineBreaks(clay)
 
 	if strings.Index(clay, builderName) == -1 {
 		singleCall := fmt.Sprintf("%s.WriteString(`%s`)", builderName, clay)
@@ -145,16 +189,9 @@ func GetElementAsBuilderSeries(elm element.Element, builderName string) (string,
 			series += htmlCall + "\n"
 			clay = strings.Replace(clay, htmlPart, "", 1)
 		}
-		endBuilderIndex := strings.Index(clay, ")")
-		loopCount := 0
-		for {
-			loopCount++
-			nextChar := string(clay[endBuilderIndex+loopCount])
-			if nextChar == ")" {
-				endBuilderIndex = endBuilderIndex + loopCount
-				continue
-			}
-			break
+		endBuilderIndex := getCallEnd(clay)
+		if endBuilderIndex == -1 {
+			return "", fmt.Errorf("unbalanced builder call found while writing: %s", elm.GetHtml())
 		}
 		builderPart := clay[:endBuilderIndex+1]
 		series += builderPart + "\n"
@@ -166,3 +203,28 @@ func GetElementAsBuilderSeries(elm element.Element, builderName string) (string,
 	}
 	return series, nil
 }
+
+// getCallEnd returns the index of the paren closing the first call in s,
+// so a call holding other calls, like gtmlEscape(gtmlCtx(ctx, "user")),
+// is kept whole. Parens inside quoted strings are skipped.
+func getCallEnd(s string) int {
+	depth := 0
+	inString := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inString && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inString = !inString
+		case inString:
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
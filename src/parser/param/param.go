@@ -2,13 +2,20 @@ package param
 
 import (
 	"fmt"
-	"gtml/src/parser/element"
-	"gtml/src/parser/gtmlrune"
 	"strings"
 
+	"github.com/phillip-england/gtml/src/parser/element"
+	"github.com/phillip-england/gtml/src/parser/gtmlrune"
 	"github.com/phillip-england/purse"
 )
 
+const (
+	KeyParamCtx       = "ctx"
+	KeyParamCtxType   = "context.Context"
+	KeyParamAttrs     = "attrs"
+	KeyParamAttrsType = "map[string]string"
+)
+
 type Param interface {
 	GetStr() string
 	GetName() string
@@ -31,7 +38,11 @@ func NewParamsFromElement(elm element.Element) ([]Param, error) {
 		}
 		for _, rn := range runes {
 			if rn.GetType() == gtmlrune.KeyRuneProp || rn.GetType() == gtmlrune.KeyRuneSlot {
-				param, err := NewParam(rn.GetValue(), "string")
+				typeof := "string"
+				if slot, ok := rn.(*gtmlrune.Slot); ok {
+					typeof = slot.GetParamType()
+				}
+				param, err := NewParam(rn.GetValue(), typeof)
 				if err != nil {
 					return err
 				}
@@ -59,6 +70,13 @@ func NewParamsFromElement(elm element.Element) ([]Param, error) {
 		if elmType == element.KeyElementSlot {
 			return nil
 		}
+		if elmType == element.KeyElementSlotDefault {
+			param, err := NewParam(child.GetAttr(), "string")
+			if err != nil {
+				return err
+			}
+			params = append(params, param)
+		}
 		if elmType == element.KeyElementElse {
 			param, err := NewParam(child.GetAttr(), "bool")
 			if err != nil {
@@ -93,7 +111,59 @@ func NewParamsFromElement(elm element.Element) ([]Param, error) {
 	if err != nil {
 		return params, err
 	}
-	// merging the params
+	// conditional attributes take bools the same way _if does, unless
+	// the condition is a _let variable of the component
+	condNames, err := element.ReadCondParams(elm.GetSelection())
+	if err != nil {
+		return params, err
+	}
+	letNames := element.ReadLetNames(elm.GetSelection())
+	for _, name := range condNames {
+		if purse.SliceContains(letNames, name) {
+			continue
+		}
+		param, err := NewParam(name, "bool")
+		if err != nil {
+			return params, err
+		}
+		elementSpecificParams = append(elementSpecificParams, param)
+	}
+	// a component spreading the attributes it is passed takes them last
+	if element.UsesRest(elm.GetSelection()) {
+		param, err := NewParam(KeyParamAttrs, KeyParamAttrsType)
+		if err != nil {
+			return params, err
+		}
+		elementSpecificParams = append(elementSpecificParams, param)
+	}
+	// a fragment takes the variables around it ahead of its other params
+	scope := element.ReadFragmentScopeParams(elm.GetSelection())
+	if len(scope) > 0 {
+		scopeParams := make([]Param, 0, len(scope))
+		scopeNames := make([]string, 0, len(scope))
+		for _, v := range scope {
+			param, err := NewParam(v.Name, v.Type)
+			if err != nil {
+				return params, err
+			}
+			scopeParams = append(scopeParams, param)
+			scopeNames = append(scopeNames, v.Name)
+		}
+		for _, p := range params {
+			if !purse.SliceContains(scopeNames, p.GetName()) {
+				scopeParams = append(scopeParams, p)
+			}
+		}
+		params = scopeParams
+	}
+	// merging the params, a component which uses the context takes it first
+	if element.UsesContext(elm) {
+		ctxParam, err := NewParam(KeyParamCtx, KeyParamCtxType)
+		if err != nil {
+			return params, err
+		}
+		params = append([]Param{ctxParam}, params...)
+	}
 	params = append(params, elementSpecificParams...)
 	filtered := make([]Param, 0)
 	found := make([]string, 0)
@@ -107,6 +177,28 @@ func NewParamsFromElement(elm element.Element) ([]Param, error) {
 	return filtered, nil
 }
 
+// NewSlotNamesFromElement returns the names of the slots elm reads with
+// $slot or _slot-default. A placeholder may leave any of them out.
+func NewSlotNamesFromElement(elm element.Element) ([]string, error) {
+	names := make([]string, 0)
+	err := element.WalkElementChildrenIncludingRoot(elm, func(child element.Element) error {
+		if child.GetType() == element.KeyElementSlotDefault {
+			names = append(names, child.GetAttr())
+		}
+		runes, err := gtmlrune.NewRunesFromElement(child)
+		if err != nil {
+			return err
+		}
+		for _, rn := range runes {
+			if rn.GetType() == gtmlrune.KeyRuneSlot {
+				names = append(names, rn.GetValue())
+			}
+		}
+		return nil
+	})
+	return names, err
+}
+
 type ParamGoFunc struct {
 	Name string
 	Type string
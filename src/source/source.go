@@ -0,0 +1,240 @@
+package source
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/phillip-england/fungi"
+)
+
+// Input is the set of component files read by a command. It is built
+// from a directory, a single .html file, or a glob such as
+// ./ui/**/*.gtml.html, and narrowed with include and exclude patterns.
+type Input struct {
+	Arg     string
+	Root    string
+	Pattern string
+	Include []string
+	Exclude []string
+}
+
+func NewInput(arg string, include []string, exclude []string) (*Input, error) {
+	in := &Input{
+		Arg:     arg,
+		Include: include,
+		Exclude: exclude,
+	}
+	err := fungi.Process(
+		func() error { return in.initRootAndPattern() },
+		func() error { return in.initValidatePatterns() },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+func (in *Input) Print()             { fmt.Println(in.Arg) }
+func (in *Input) GetRoot() string    { return in.Root }
+func (in *Input) GetPattern() string { return in.Pattern }
+
+// IsGlob reports whether arg contains any glob characters.
+func IsGlob(arg string) bool {
+	return strings.ContainsAny(arg, "*?[")
+}
+
+func (in *Input) initRootAndPattern() error {
+	if in.Arg == "" {
+		return fmt.Errorf("missing input")
+	}
+	if IsGlob(in.Arg) {
+		// the root is every leading segment without a glob character
+		parts := strings.Split(filepath.ToSlash(in.Arg), "/")
+		rootParts := make([]string, 0)
+		for i, part := range parts {
+			if IsGlob(part) {
+				in.Pattern = strings.Join(parts[i:], "/")
+				break
+			}
+			rootParts = append(rootParts, part)
+		}
+		root := strings.Join(rootParts, "/")
+		if root == "" && strings.HasPrefix(in.Arg, "/") {
+			root = "/"
+		}
+		if root == "" {
+			root = "."
+		}
+		in.Root = filepath.Clean(filepath.FromSlash(root))
+		info, err := os.Stat(in.Root)
+		if err != nil || !info.IsDir() {
+			return fmt.Errorf("the directory %s in the pattern %s does not exist", in.Root, in.Arg)
+		}
+		return nil
+	}
+	info, err := os.Stat(in.Arg)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("the path %s does not exist", in.Arg)
+		}
+		return err
+	}
+	if info.IsDir() {
+		in.Root = filepath.Clean(in.Arg)
+		return nil
+	}
+	if !strings.HasSuffix(in.Arg, ".html") {
+		return fmt.Errorf("the file %s is not an .html file", in.Arg)
+	}
+	in.Root = filepath.Dir(in.Arg)
+	in.Pattern = filepath.Base(in.Arg)
+	return nil
+}
+
+func (in *Input) initValidatePatterns() error {
+	patterns := make([]string, 0)
+	patterns = append(patterns, in.Pattern)
+	patterns = append(patterns, in.Include...)
+	patterns = append(patterns, in.Exclude...)
+	for _, pattern := range patterns {
+		for _, part := range strings.Split(pattern, "/") {
+			if part == "**" {
+				continue
+			}
+			_, err := path.Match(part, "")
+			if err != nil {
+				return fmt.Errorf("invalid pattern %s: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetPaths returns every file of the input in walk order.
+func (in *Input) GetPaths() ([]string, error) {
+	paths := make([]string, 0)
+	err := filepath.WalkDir(in.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != in.Root && in.IsExcluded(p) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if in.Matches(p) {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return paths, err
+	}
+	return paths, nil
+}
+
+// Matches reports whether the file at p is part of the input.
+func (in *Input) Matches(p string) bool {
+	rel, ok := in.rel(p)
+	if !ok {
+		return false
+	}
+	if in.Pattern != "" {
+		if !Match(in.Pattern, rel) {
+			return false
+		}
+	} else if !strings.HasSuffix(rel, ".html") {
+		return false
+	}
+	if len(in.Include) > 0 {
+		included := false
+		for _, pattern := range in.Include {
+			if matchAnywhere(pattern, rel) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	return !in.IsExcluded(p)
+}
+
+// IsExcluded reports whether p, or one of the directories it is in, is
+// matched by an exclude pattern.
+func (in *Input) IsExcluded(p string) bool {
+	rel, ok := in.rel(p)
+	if !ok {
+		return false
+	}
+	for _, pattern := range in.Exclude {
+		if matchAnywhere(pattern, rel) {
+			return true
+		}
+		parts := strings.Split(rel, "/")
+		for i := 1; i < len(parts); i++ {
+			if matchAnywhere(pattern, strings.Join(parts[:i], "/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rel returns p relative to the root in slash form.
+func (in *Input) rel(p string) (string, bool) {
+	rel, err := filepath.Rel(in.Root, p)
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
+
+// matchAnywhere matches patterns without a slash against the last
+// element of rel, like a .gitignore entry, and all others against the
+// whole of rel.
+func matchAnywhere(pattern string, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		return Match(pattern, path.Base(rel))
+	}
+	return Match(pattern, rel)
+}
+
+// Match reports whether the slash separated name matches pattern. It
+// follows path.Match, and a "**" segment matches any number of
+// directories, including none.
+func Match(pattern string, name string) bool {
+	return matchParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchParts(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchParts(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, err := path.Match(pattern[0], name[0])
+	if err != nil || !ok {
+		return false
+	}
+	return matchParts(pattern[1:], name[1:])
+}